@@ -2,15 +2,19 @@ package main
 
 import (
 	"cloudstream/internal/api"
+	"cloudstream/internal/auth"
 	"cloudstream/internal/core"
 	"cloudstream/internal/database"
 	"cloudstream/internal/logger"
+	"cloudstream/internal/notify"
+	"cloudstream/internal/pan123"
 	"context"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -24,6 +28,19 @@ func main() {
 		log.Fatal().Err(err).Msg("无法连接到数据库")
 	}
 
+	// 恢复登录锁定状态，失败告警走通知渠道
+	auth.LoginAlertFunc = func(message string) {
+		core.SendEvent(notify.EventData{Event: notify.EventLoginAlert, Message: message})
+	}
+	auth.InitLoginGuard()
+
+	// 通知发件箱、汇总通知与账户授权失败告警
+	pan123.TokenFailureHook = core.NotifyTokenFailure
+	// 云盘接口失败重试次数
+	pan123.SetMaxAttempts(database.GetSystemSetting().ProviderMaxAttempts)
+	core.StartDeliveryWorker()
+	core.StartDigestWorker()
+
 	// 初始化调度器
 	core.InitScheduler()
 
@@ -51,12 +68,39 @@ func main() {
 	<-quit
 	log.Info().Msg("正在停止服务...")
 
-	// 给予 5 秒时间让正在处理的请求完成
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// 容器默认宽限期为 10 秒：HTTP 排空与任务停止同时进行，共用 8 秒期限，剩余时间留给通知协程
+	deadline := time.Now().Add(9 * time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline.Add(-time.Second))
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal().Err(err).Msg("服务强制停止")
-	}
 
+	var wg sync.WaitGroup
+	var tasksStopped bool
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("服务强制停止")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// 停止调度器与运行中的任务，等待它们保存断点并写入最终状态
+		tasksStopped = core.Shutdown(ctx)
+	}()
+	wg.Wait()
+
+	// 停止发件箱投递与汇总协程，未发送的消息保留在发件箱中，重启后继续投递
+	workerCtx, workerCancel := context.WithDeadline(context.Background(), deadline)
+	defer workerCancel()
+	workersStopped := core.StopWorkers(workerCtx)
+
+	// 仍有协程在使用数据库时不关闭连接，由进程退出释放
+	if tasksStopped && workersStopped {
+		if err := database.Close(); err != nil {
+			log.Error().Err(err).Msg("关闭数据库失败")
+		}
+	} else {
+		log.Warn().Msg("仍有任务或通知协程未结束，跳过关闭数据库")
+	}
 	log.Info().Msg("服务已退出")
-}
\ No newline at end of file
+}
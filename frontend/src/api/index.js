@@ -3,6 +3,22 @@ import { createDiscreteApi } from 'naive-ui'
 
 const { message } = createDiscreteApi(['message'])
 
+const TOKEN_KEY = 'jwt_token'
+const REFRESH_KEY = 'refresh_token'
+
+// 登录或刷新成功后保存访问令牌与刷新令牌
+export function saveTokens(res) {
+  localStorage.setItem(TOKEN_KEY, res.token)
+  if (res.refreshToken) {
+    localStorage.setItem(REFRESH_KEY, res.refreshToken)
+  }
+}
+
+export function clearTokens() {
+  localStorage.removeItem(TOKEN_KEY)
+  localStorage.removeItem(REFRESH_KEY)
+}
+
 const api = axios.create({
   baseURL: '/api/v1',
   // 核心修复：延长到 60 秒 (60000ms)，解决大目录加载超时
@@ -10,24 +26,66 @@ const api = axios.create({
 })
 
 api.interceptors.request.use(config => {
-  const token = localStorage.getItem('jwt_token')
+  const token = localStorage.getItem(TOKEN_KEY)
   if (token) {
     config.headers.Authorization = `Bearer ${token}`
   }
   return config
 })
 
+// 同一时间只发起一次刷新，其余请求等待同一个结果
+let refreshing = null
+
+function refreshAccessToken() {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem(REFRESH_KEY)
+    refreshing = axios.post('/api/v1/token/refresh', { refreshToken })
+      .then(res => {
+        saveTokens(res.data)
+        return res.data.token
+      })
+      .catch(err => {
+        // 其他标签页已轮换了刷新令牌时，直接使用它换到的访问令牌
+        if (localStorage.getItem(REFRESH_KEY) !== refreshToken) {
+          return localStorage.getItem(TOKEN_KEY)
+        }
+        throw err
+      })
+      .finally(() => { refreshing = null })
+  }
+  return refreshing
+}
+
+function redirectToLogin() {
+  clearTokens()
+  // 防止重复跳转
+  if (!window.location.pathname.includes('/login')) {
+    window.location.href = '/login'
+  }
+}
+
 api.interceptors.response.use(
   res => res.data,
-  err => {
+  async err => {
+    const config = err.config
     if (err.response && err.response.status === 401) {
-      // 防止重复跳转
-      if (!window.location.pathname.includes('/login')) {
-        localStorage.removeItem('jwt_token')
-        window.location.href = '/login'
+      // 访问令牌过期：用刷新令牌换取新令牌后重试一次
+      if (config && !config._retried && localStorage.getItem(REFRESH_KEY) && !config.url.startsWith('/login')) {
+        config._retried = true
+        try {
+          const token = await refreshAccessToken()
+          config.headers.Authorization = `Bearer ${token}`
+          return api(config)
+        } catch (e) {
+          redirectToLogin()
+          return Promise.reject(err)
+        }
+      }
+      if (!config || !config.url.startsWith('/login')) {
+        redirectToLogin()
       }
     }
-    
+
     // 优化错误提示
     let msg = '未知错误'
     if (err.code === 'ECONNABORTED' && err.message.includes('timeout')) {
@@ -35,10 +93,10 @@ api.interceptors.response.use(
     } else {
       msg = err.response?.data?.message || err.response?.data?.error || err.message
     }
-    
+
     message.error(msg)
     return Promise.reject(err)
   }
 )
 
-export default api
\ No newline at end of file
+export default api
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"cloudstream/internal/auth"
 	"cloudstream/internal/core"
 	"cloudstream/internal/database"
 	"cloudstream/internal/models"
+	"cloudstream/internal/pan123"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
@@ -13,6 +15,17 @@ func ListAccountsHandler(c *gin.Context) {
 	var accounts []models.Account
 	// 修复：按 ID 升序排列
 	database.DB.Order("id asc").Find(&accounts)
+	// 只读用户只能看到账户的基本信息，不返回云盘凭证
+	if !auth.IsAdmin(c) {
+		for i := range accounts {
+			if accounts[i].ClientSecret != "" {
+				accounts[i].ClientSecret = redactedValue
+			}
+			if accounts[i].OpenListToken != "" {
+				accounts[i].OpenListToken = redactedValue
+			}
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"code": 0, "data": accounts})
 }
 
@@ -37,6 +50,9 @@ func validateAccount(a *models.Account) (ok bool, msg string) {
 	default:
 		return false, "不支持的云账户类型"
 	}
+	if a.ListQPS < 0 || a.ListBurst < 0 || a.DownloadQPS < 0 || a.DownloadBurst < 0 {
+		return false, "限流参数不能为负数"
+	}
 	return true, ""
 }
 
@@ -56,6 +72,7 @@ func CreateAccountHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "创建账户失败: " + err.Error()})
 		return
 	}
+	recordAudit(c, "account.create", "account", account.ID, account.Name, nil, account)
 	c.JSON(http.StatusOK, gin.H{"code": 0, "data": account})
 }
 
@@ -67,6 +84,7 @@ func UpdateAccountHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "账户未找到"})
 		return
 	}
+	before := account
 
 	if err := c.ShouldBindJSON(&account); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
@@ -82,6 +100,7 @@ func UpdateAccountHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "更新账户失败: " + err.Error()})
 		return
 	}
+	recordAudit(c, "account.update", "account", account.ID, account.Name, before, account)
 	c.JSON(http.StatusOK, gin.H{"code": 0, "data": account})
 }
 
@@ -94,15 +113,25 @@ func DeleteAccountHandler(c *gin.Context) {
 	}
 	accountID := uint(id)
 
+	var account models.Account
+	if err := database.DB.First(&account, accountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "账户未找到"})
+		return
+	}
+
 	var tasksUsingAccount []models.Task
 	database.DB.Where("account_id = ?", accountID).Find(&tasksUsingAccount)
 
 	for _, task := range tasksUsingAccount {
 		core.StopTask(task.ID)
 		database.DB.Unscoped().Delete(&task)
+		core.ClearCheckpoint(task.ID)
+		core.DeleteTaskDependencies(task.ID)
+		core.RefreshTask(task.ID)
 	}
 
 	database.DB.Unscoped().Delete(&models.Account{}, accountID)
-	core.RefreshScheduler()
+	pan123.ClearLimiter(accountID)
+	recordAudit(c, "account.delete", "account", accountID, account.Name, account, nil)
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "账户及关联任务已删除"})
 }
\ No newline at end of file
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"cloudstream/internal/auth"
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redactedValue = "******"
+
+// 审计差异中忽略的字段：时间戳、运行进度等非用户操作产生的变化
+var auditIgnoredFields = map[string]bool{
+	"CreatedAt":      true,
+	"UpdatedAt":      true,
+	"DeletedAt":      true,
+	"ProcessedCount": true,
+	"LastRunStatus":  true,
+}
+
+func isSensitiveField(name string) bool {
+	lower := strings.ToLower(name)
+	for _, keyword := range []string{"password", "secret", "token", "key", "hash", "authorization", "webhookurl"} {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func toFieldMap(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case float64:
+		return t == 0
+	case bool:
+		return !t
+	}
+	return false
+}
+
+// redactEmbeddedJSON 对以 JSON 字符串保存的配置 (如通知渠道 Settings) 中的敏感字段脱敏
+func redactEmbeddedJSON(v interface{}) interface{} {
+	str, ok := v.(string)
+	if !ok || !strings.HasPrefix(strings.TrimSpace(str), "{") {
+		return v
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(str), &fields); err != nil {
+		return v
+	}
+	redactFields(fields)
+	return fields
+}
+
+// redactFields 将敏感字段替换为掩码，嵌套对象 (如 Webhook 的自定义 Headers) 一并处理
+func redactFields(fields map[string]interface{}) {
+	for k, val := range fields {
+		if nested, ok := val.(map[string]interface{}); ok {
+			redactFields(nested)
+			continue
+		}
+		if isSensitiveField(k) && !isEmptyValue(val) {
+			fields[k] = redactedValue
+		}
+	}
+}
+
+// auditDiff 对比前后两个对象，返回变化字段的 JSON；敏感字段只记录“已修改”
+func auditDiff(before, after interface{}) string {
+	oldFields, newFields := toFieldMap(before), toFieldMap(after)
+	keys := make(map[string]struct{})
+	for k := range oldFields {
+		keys[k] = struct{}{}
+	}
+	for k := range newFields {
+		keys[k] = struct{}{}
+	}
+
+	diff := make(map[string]map[string]interface{})
+	for k := range keys {
+		if auditIgnoredFields[k] {
+			continue
+		}
+		oldVal, newVal := oldFields[k], newFields[k]
+		if reflect.DeepEqual(oldVal, newVal) || (isEmptyValue(oldVal) && isEmptyValue(newVal)) {
+			continue
+		}
+		if isSensitiveField(k) {
+			change := map[string]interface{}{}
+			if !isEmptyValue(oldVal) {
+				change["old"] = redactedValue
+			}
+			if !isEmptyValue(newVal) {
+				change["new"] = redactedValue
+			}
+			diff[k] = change
+			continue
+		}
+		diff[k] = map[string]interface{}{"old": redactEmbeddedJSON(oldVal), "new": redactEmbeddedJSON(newVal)}
+	}
+	if len(diff) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(diff)
+	return string(data)
+}
+
+// recordAudit 写入一条审计记录；before/after 可为 nil (创建、删除或无对象的操作)
+func recordAudit(c *gin.Context, action, targetType string, targetID uint, targetName string, before, after interface{}) {
+	actor, _ := c.Get("username")
+	actorName, _ := actor.(string)
+	entry := models.AuditLog{
+		Actor:      actorName,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		TargetName: targetName,
+		Diff:       auditDiff(before, after),
+		IP:         auth.ClientIP(c),
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Error().Err(err).Str("action", action).Msg("写入审计日志失败")
+	}
+}
+
+func parseTimeParam(v string) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// ListAuditLogsHandler 分页查询审计日志，支持按操作人、动作、对象和时间范围过滤
+func ListAuditLogsHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 20
+	}
+
+	query := database.DB.Model(&models.AuditLog{})
+	if actor := c.Query("actor"); actor != "" {
+		query = query.Where("actor = ?", actor)
+	}
+	if action := c.Query("action"); action != "" {
+		// 支持前缀过滤，例如 action=task 匹配 task.create / task.delete
+		query = query.Where("action = ? OR action LIKE ?", action, action+".%")
+	}
+	if targetType := c.Query("targetType"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("targetId"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if from, ok := parseTimeParam(c.Query("from")); ok {
+		query = query.Where("created_at >= ?", from)
+	}
+	if to, ok := parseTimeParam(c.Query("to")); ok {
+		if len(c.Query("to")) == len("2006-01-02") {
+			to = to.Add(24 * time.Hour)
+		}
+		query = query.Where("created_at < ?", to)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "查询审计日志失败: " + err.Error()})
+		return
+	}
+	var logs []models.AuditLog
+	if err := query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "查询审计日志失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"list":     logs,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}})
+}
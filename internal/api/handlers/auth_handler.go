@@ -1,13 +1,15 @@
 package handlers
 
 import (
+	"cloudstream/internal/auth"
 	"cloudstream/internal/database"
 	"cloudstream/internal/models"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 )
 
-// LogoutHandler 强制使当前用户的旧 Token 失效
+// LogoutHandler 吊销当前会话，其他设备上的登录不受影响
 func LogoutHandler(c *gin.Context) {
 	username, exists := c.Get("username")
 	if !exists {
@@ -21,9 +23,65 @@ func LogoutHandler(c *gin.Context) {
 		return
 	}
 
-	// 核心逻辑：版本号自增
-	user.TokenVersion++
-	database.DB.Save(&user)
+	if sessionID := c.GetUint("sessionID"); sessionID != 0 {
+		auth.RevokeSession(user.ID, sessionID)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "安全退出成功"})
-}
\ No newline at end of file
+}
+
+// LogoutAllHandler 退出所有设备：版本号自增并吊销全部会话
+func LogoutAllHandler(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	user.TokenVersion++
+	database.DB.Model(user).Update("token_version", user.TokenVersion)
+	auth.RevokeAllSessions(user.ID)
+	recordAudit(c, "session.revoke_all", "user", user.ID, user.Username, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "已退出所有设备"})
+}
+
+// ListSessionsHandler 列出当前用户的活跃会话
+func ListSessionsHandler(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	sessions, err := auth.ListActiveSessions(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "获取会话列表失败: " + err.Error()})
+		return
+	}
+
+	type SessionWithCurrent struct {
+		models.Session
+		Current bool `json:"Current"`
+	}
+	currentID := c.GetUint("sessionID")
+	result := make([]SessionWithCurrent, len(sessions))
+	for i, s := range sessions {
+		result[i] = SessionWithCurrent{Session: s, Current: s.ID == currentID}
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": result})
+}
+
+// RevokeSessionHandler 吊销当前用户的指定会话
+func RevokeSessionHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "无效的会话ID"})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if err := auth.RevokeSession(user.ID, uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	recordAudit(c, "session.revoke", "session", uint(id), user.Username, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "会话已注销"})
+}
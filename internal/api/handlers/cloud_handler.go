@@ -3,7 +3,6 @@ package handlers
 import (
 	"cloudstream/internal/database"
 	"cloudstream/internal/models"
-	"cloudstream/internal/openlist"
 	"cloudstream/internal/pan123"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -39,6 +38,8 @@ func FileBrowserHandler(c *gin.Context) {
 
 	parentParam := c.Query("parentFileId")
 	var fileList []CloudFileDTO
+	// 与扫描、播放共享账户的限流额度
+	client := pan123.NewClient(account).WithContext(c.Request.Context())
 
 	switch account.Type {
 	case models.AccountTypeOpenList:
@@ -48,30 +49,23 @@ func FileBrowserHandler(c *gin.Context) {
 			parentPath = "/"
 		}
 
-		client := openlist.NewClient(account)
-		items, err := client.ListDirectory(parentPath, false)
+		items, err := client.ListOpenListDirectory(parentPath)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": fmt.Sprintf("获取 OpenList 文件列表失败: %s", err.Error())})
 			return
 		}
 
 		for _, item := range items {
-			childPath := joinOpenListPath(parentPath, item.Name)
-			t := 0
-			if item.IsDir {
-				t = 1
-			}
 			fileList = append(fileList, CloudFileDTO{
-				FileId:   childPath,
-				FileName: item.Name,
-				Type:     t,
+				FileId:   joinOpenListPath(parentPath, item.FileName),
+				FileName: item.FileName,
+				Type:     item.FileType,
 			})
 		}
 
 	default: // 123 云盘开放平台
 		parentFileId, _ := strconv.ParseInt(parentParam, 10, 64)
 		limit := 100
-		client := pan123.NewClient(account)
 
 		var lastFileId int64 = 0
 		for {
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"cloudstream/internal/core"
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ListNotificationDeliveriesHandler 查询通知发件箱，默认返回未成功的投递
+func ListNotificationDeliveriesHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 20
+	}
+
+	query := database.DB.Model(&models.NotificationDelivery{})
+	switch status := c.DefaultQuery("status", "failed"); status {
+	case "all":
+	case "failed":
+		// 等待重试 (至少失败过一次) 或已放弃的投递
+		query = query.Where("status = ? OR (status = ? AND attempts > 0)", models.DeliveryDead, models.DeliveryPending)
+	default:
+		query = query.Where("status = ?", status)
+	}
+	if channelID := c.Query("channelId"); channelID != "" {
+		query = query.Where("channel_id = ?", channelID)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "查询投递记录失败: " + err.Error()})
+		return
+	}
+	var deliveries []models.NotificationDelivery
+	if err := query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "查询投递记录失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"list":     deliveries,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}})
+}
+
+// RetryNotificationDeliveryHandler 立即重新投递一条失败的消息
+func RetryNotificationDeliveryHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "无效的记录 ID"})
+		return
+	}
+	if err := core.RetryDelivery(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	recordAudit(c, "delivery.retry", "delivery", uint(id), "", nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "已重新加入发送队列"})
+}
+
+// RetryDeadNotificationDeliveriesHandler 重新投递所有已放弃的消息
+func RetryDeadNotificationDeliveriesHandler(c *gin.Context) {
+	count, err := core.RetryDeadDeliveries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "重新投递失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "delivery.retry_all", "delivery", 0, "", nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "已重新加入发送队列", "data": gin.H{"count": count}})
+}
+
+// DeleteNotificationDeliveryHandler 删除一条投递记录
+func DeleteNotificationDeliveryHandler(c *gin.Context) {
+	var delivery models.NotificationDelivery
+	if err := database.DB.First(&delivery, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "投递记录未找到"})
+		return
+	}
+	if err := database.DB.Delete(&delivery).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "删除失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "delivery.delete", "delivery", delivery.ID, delivery.ChannelName, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "投递记录已删除"})
+}
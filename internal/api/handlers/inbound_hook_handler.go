@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"cloudstream/internal/auth"
+	"cloudstream/internal/core"
+	"cloudstream/internal/database"
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+)
+
+// InboundHookTokenHeader 入站 Webhook 的鉴权请求头；不接受 URL 参数传递，避免 token 出现在访问日志中
+const InboundHookTokenHeader = "X-CloudStream-Token"
+
+// InboundScanHookHandler 外部系统 (下载器、网盘事件等) 通知某个云盘路径或目录有变化，
+// 找到包含该目录的任务后只扫描这一子目录，结果合并进任务已有的文件记录
+func InboundScanHookHandler(c *gin.Context) {
+	expected := database.GetSystemSetting().InboundWebhookToken
+	if expected == "" {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "入站 Webhook 未启用"})
+		return
+	}
+	token := c.GetHeader(InboundHookTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		log.Warn().Str("ip", auth.ClientIP(c)).Msg("入站 Webhook 鉴权失败")
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "message": "token 无效"})
+		return
+	}
+
+	var req struct {
+		Path      string `json:"path" form:"path"`
+		FolderID  string `json:"folderId" form:"folderId"`
+		AccountID uint   `json:"accountId" form:"accountId"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	req.Path = strings.TrimSpace(req.Path)
+	req.FolderID = strings.TrimSpace(req.FolderID)
+	if req.Path == "" && req.FolderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "path 和 folderId 至少需要提供一个"})
+		return
+	}
+
+	targets, err := core.FindSubtreeTargets(req.AccountID, req.FolderID, req.Path)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"code": 1, "message": "解析云盘路径失败: " + err.Error()})
+		return
+	}
+	if len(targets) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "没有任务包含该目录"})
+		return
+	}
+
+	results := make([]gin.H, 0, len(targets))
+	for _, target := range targets {
+		started := core.RunSubtreeScan(target.Task, target.Scope, core.RunSourceWebhook)
+		results = append(results, gin.H{
+			"taskId":   target.Task.ID,
+			"taskName": target.Task.Name,
+			"subPath":  target.Scope.RelPath,
+			"started":  started,
+			"queued":   started && core.IsTaskQueued(target.Task.ID),
+		})
+		log.Info().Str("任务", target.Task.Name).Str("子目录", target.Scope.RelPath).Bool("已启动", started).
+			Str("ip", auth.ClientIP(c)).Msg("入站 Webhook 触发子目录扫描")
+	}
+	c.JSON(http.StatusAccepted, gin.H{"code": 0, "data": results})
+}
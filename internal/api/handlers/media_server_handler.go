@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"cloudstream/internal/core"
+	"cloudstream/internal/database"
+	"cloudstream/internal/mediaserver"
+	"cloudstream/internal/models"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+func validateMediaServer(s *models.MediaServer) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("媒体服务器名称不能为空")
+	}
+	// 构造一次客户端以校验类型和必填项
+	if _, err := core.NewMediaServer(*s); err != nil {
+		return err
+	}
+	if _, err := mediaserver.ParsePathMappings(s.PathMappings); err != nil {
+		return err
+	}
+	// 已保存的服务器修改映射后，使用按目录刷新的任务仍需被覆盖
+	if s.ID != 0 {
+		var tasks []models.Task
+		database.DB.Where("media_server_id = ? AND refresh_mode = ?", s.ID, models.RefreshModePath).Find(&tasks)
+		for _, task := range tasks {
+			if err := core.ValidateTaskPathMapping(task, *s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// redactMediaServer 返回隐藏了 API Key 的服务器副本，用于接口响应；审计差异按字段名脱敏，无需额外处理
+func redactMediaServer(s models.MediaServer) models.MediaServer {
+	if s.APIKey != "" {
+		s.APIKey = redactedValue
+	}
+	return s
+}
+
+func ListMediaServersHandler(c *gin.Context) {
+	var servers []models.MediaServer
+	database.DB.Order("id asc").Find(&servers)
+	for i := range servers {
+		servers[i] = redactMediaServer(servers[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": servers})
+}
+
+// ListMediaServerTypesHandler 返回支持的媒体服务器类型与刷新方式
+func ListMediaServerTypesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"types":        mediaserver.Types(),
+		"refreshModes": []string{models.RefreshModeFull, models.RefreshModePath},
+	}})
+}
+
+func CreateMediaServerHandler(c *gin.Context) {
+	// 未提交 Enabled 时默认启用
+	server := models.MediaServer{Enabled: true}
+	if err := c.ShouldBindJSON(&server); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	if err := validateMediaServer(&server); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&server).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "创建媒体服务器失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "mediaserver.create", "mediaserver", server.ID, server.Name, nil, server)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": redactMediaServer(server)})
+}
+
+func UpdateMediaServerHandler(c *gin.Context) {
+	var server models.MediaServer
+	if err := database.DB.First(&server, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "媒体服务器未找到"})
+		return
+	}
+	before := server
+	if err := c.ShouldBindJSON(&server); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	server.ID = before.ID
+	// 提交回来的掩码表示未修改 API Key
+	if server.APIKey == redactedValue {
+		server.APIKey = before.APIKey
+	}
+	if err := validateMediaServer(&server); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := database.DB.Save(&server).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "更新媒体服务器失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "mediaserver.update", "mediaserver", server.ID, server.Name, before, server)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": redactMediaServer(server)})
+}
+
+func DeleteMediaServerHandler(c *gin.Context) {
+	var server models.MediaServer
+	if err := database.DB.First(&server, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "媒体服务器未找到"})
+		return
+	}
+	var count int64
+	database.DB.Model(&models.Task{}).Where("media_server_id = ?", server.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"code": 1, "message": fmt.Sprintf("仍有 %d 个任务使用该媒体服务器，请先修改任务设置", count)})
+		return
+	}
+	if err := database.DB.Unscoped().Delete(&server).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "删除媒体服务器失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "mediaserver.delete", "mediaserver", server.ID, server.Name, server, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "媒体服务器已删除"})
+}
+
+// TestMediaServerHandler 测试已保存的媒体服务器连接
+func TestMediaServerHandler(c *gin.Context) {
+	var server models.MediaServer
+	if err := database.DB.First(&server, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "媒体服务器未找到"})
+		return
+	}
+	testMediaServer(c, server)
+}
+
+// TestMediaServerConfigHandler 使用未保存的配置测试连接
+func TestMediaServerConfigHandler(c *gin.Context) {
+	var server models.MediaServer
+	if err := c.ShouldBindJSON(&server); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	// 编辑已保存的服务器时，未修改的 API Key 以掩码提交
+	if server.ID != 0 && server.APIKey == redactedValue {
+		var stored models.MediaServer
+		if err := database.DB.First(&stored, server.ID).Error; err == nil {
+			server.APIKey = stored.APIKey
+		}
+	}
+	testMediaServer(c, server)
+}
+
+func testMediaServer(c *gin.Context, server models.MediaServer) {
+	client, err := core.NewMediaServer(server)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := client.Test(); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"code": 1, "message": "连接失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "连接成功"})
+}
+
+// RefreshMediaServerHandler 手动触发全部媒体库刷新
+func RefreshMediaServerHandler(c *gin.Context) {
+	var server models.MediaServer
+	if err := database.DB.First(&server, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "媒体服务器未找到"})
+		return
+	}
+	client, err := core.NewMediaServer(server)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := client.RefreshLibrary(); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"code": 1, "message": "刷新失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "mediaserver.refresh", "mediaserver", server.ID, server.Name, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "已通知媒体服务器刷新媒体库"})
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"cloudstream/internal/core"
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"cloudstream/internal/notify"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func validateChannel(ch *models.NotificationChannel) error {
+	ch.Name = strings.TrimSpace(ch.Name)
+	if ch.Name == "" {
+		return fmt.Errorf("渠道名称不能为空")
+	}
+	if strings.TrimSpace(ch.Settings) == "" {
+		ch.Settings = "{}"
+	}
+	if !json.Valid([]byte(ch.Settings)) {
+		return fmt.Errorf("渠道配置不是有效的 JSON")
+	}
+	if ch.Format != "" && !notify.ValidFormat(ch.Format) {
+		return fmt.Errorf("不支持的消息格式: %s", ch.Format)
+	}
+	events, err := normalizeList(ch.Events, func(e string) bool {
+		for _, known := range notify.Events {
+			if e == known {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return fmt.Errorf("不支持的事件类型: %s", err.Error())
+	}
+	ch.Events = events
+	taskIDs, err := normalizeList(ch.TaskIDs, func(id string) bool {
+		_, err := strconv.ParseUint(id, 10, 64)
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("无效的任务 ID: %s", err.Error())
+	}
+	ch.TaskIDs = taskIDs
+	switch ch.DigestMode {
+	case "", core.DigestHourly:
+	case core.DigestDaily:
+		if strings.TrimSpace(ch.DigestTime) == "" {
+			ch.DigestTime = "09:00"
+		}
+		if _, _, err := core.ParseDigestTime(ch.DigestTime); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("不支持的汇总模式: %s", ch.DigestMode)
+	}
+	// 构造一次 Notifier 以校验必填项
+	if _, err := notify.New(ch.Type, ch.Settings); err != nil {
+		return err
+	}
+	return nil
+}
+
+// normalizeList 清理逗号分隔的列表并逐项校验，校验失败时返回该项
+func normalizeList(value string, valid func(string) bool) (string, error) {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !valid(item) {
+			return "", fmt.Errorf("%s", item)
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// redactChannel 返回隐藏了敏感配置的渠道副本，用于接口响应
+func redactChannel(ch models.NotificationChannel) models.NotificationChannel {
+	if fields, ok := redactEmbeddedJSON(ch.Settings).(map[string]interface{}); ok {
+		data, _ := json.Marshal(fields)
+		ch.Settings = string(data)
+	}
+	return ch
+}
+
+// restoreRedactedSettings 提交回来的掩码表示未修改，沿用已保存的配置值
+func restoreRedactedSettings(submitted, stored string) string {
+	var fields, old map[string]interface{}
+	if json.Unmarshal([]byte(submitted), &fields) != nil || json.Unmarshal([]byte(stored), &old) != nil {
+		return submitted
+	}
+	if !restoreFields(fields, old) {
+		return submitted
+	}
+	data, _ := json.Marshal(fields)
+	return string(data)
+}
+
+func restoreFields(fields, old map[string]interface{}) bool {
+	restored := false
+	for k, val := range fields {
+		if nested, ok := val.(map[string]interface{}); ok {
+			if oldNested, ok := old[k].(map[string]interface{}); ok && restoreFields(nested, oldNested) {
+				restored = true
+			}
+			continue
+		}
+		if val == redactedValue {
+			if oldVal, ok := old[k]; ok {
+				fields[k] = oldVal
+				restored = true
+			}
+		}
+	}
+	return restored
+}
+
+func ListNotificationChannelsHandler(c *gin.Context) {
+	var channels []models.NotificationChannel
+	database.DB.Order("id asc").Find(&channels)
+	for i := range channels {
+		channels[i] = redactChannel(channels[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": channels})
+}
+
+// ListNotificationTypesHandler 返回支持的渠道类型与事件类型
+func ListNotificationTypesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"types":       notify.Types(),
+		"events":      notify.Events,
+		"formats":     []string{notify.FormatPlain, notify.FormatMarkdown, notify.FormatHTML},
+		"digestModes": []string{core.DigestHourly, core.DigestDaily},
+	}})
+}
+
+func CreateNotificationChannelHandler(c *gin.Context) {
+	// 未提交 Enabled 时默认启用
+	channel := models.NotificationChannel{Enabled: true}
+	if err := c.ShouldBindJSON(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	if err := validateChannel(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "创建渠道失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "channel.create", "channel", channel.ID, channel.Name, nil, channel)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": redactChannel(channel)})
+}
+
+func UpdateNotificationChannelHandler(c *gin.Context) {
+	var channel models.NotificationChannel
+	if err := database.DB.First(&channel, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "通知渠道未找到"})
+		return
+	}
+	before := channel
+	if err := c.ShouldBindJSON(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	channel.ID = before.ID
+	channel.Settings = restoreRedactedSettings(channel.Settings, before.Settings)
+	if err := validateChannel(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := database.DB.Save(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "更新渠道失败: " + err.Error()})
+		return
+	}
+	if channel.DigestMode == "" && before.DigestMode != "" {
+		// 关闭汇总后丢弃尚未发送的暂存事件
+		database.DB.Where("channel_id = ?", channel.ID).Delete(&models.NotificationDigestItem{})
+	}
+	recordAudit(c, "channel.update", "channel", channel.ID, channel.Name, before, channel)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": redactChannel(channel)})
+}
+
+func DeleteNotificationChannelHandler(c *gin.Context) {
+	var channel models.NotificationChannel
+	if err := database.DB.First(&channel, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "通知渠道未找到"})
+		return
+	}
+	if err := database.DB.Unscoped().Delete(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "删除渠道失败: " + err.Error()})
+		return
+	}
+	database.DB.Where("channel_id = ?", channel.ID).Delete(&models.NotificationDigestItem{})
+	recordAudit(c, "channel.delete", "channel", channel.ID, channel.Name, channel, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "通知渠道已删除"})
+}
+
+// TestNotificationChannelHandler 通过已保存的渠道发送测试消息
+func TestNotificationChannelHandler(c *gin.Context) {
+	var channel models.NotificationChannel
+	if err := database.DB.First(&channel, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "通知渠道未找到"})
+		return
+	}
+	if err := core.SendTestNotification(channel.Type, channel.Settings, channel.Format); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "测试发送失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "测试消息发送成功！"})
+}
+
+// TestNotificationConfigHandler 使用未保存的渠道配置发送测试消息
+func TestNotificationConfigHandler(c *gin.Context) {
+	var channel models.NotificationChannel
+	if err := c.ShouldBindJSON(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	// 编辑已有渠道时测试，未修改的敏感字段以掩码提交
+	var stored models.NotificationChannel
+	if channel.ID != 0 && database.DB.First(&stored, channel.ID).Error == nil {
+		channel.Settings = restoreRedactedSettings(channel.Settings, stored.Settings)
+	}
+	if err := core.SendTestNotification(channel.Type, channel.Settings, channel.Format); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "测试发送失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "测试消息发送成功！"})
+}
+
+// TestNotificationTypeHandler 按渠道类型测试，请求体即该类型的渠道配置 JSON
+func TestNotificationTypeHandler(c *gin.Context) {
+	settings, err := c.GetRawData()
+	if err != nil || !json.Valid(settings) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "渠道配置不是有效的 JSON"})
+		return
+	}
+	if err := core.SendTestNotification(c.Param("type"), string(settings), c.Query("format")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "测试发送失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "测试消息发送成功！"})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"cloudstream/internal/core"
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"cloudstream/internal/notify"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// 模板中可用的变量，供前端编辑器提示
+var templateVariables = []gin.H{
+	{"name": ".TaskName", "description": "任务名称"},
+	{"name": ".AccountName", "description": "云账户名称"},
+	{"name": ".Status", "description": "任务结束状态"},
+	{"name": ".ProcessedCount", "description": "处理文件数"},
+	{"name": ".AddedCount", "description": "新增文件数"},
+	{"name": ".DeletedCount", "description": "清理的失效文件数"},
+	{"name": ".Duration", "description": "耗时，配合 duration 函数格式化"},
+	{"name": ".StartedAt", "description": "开始时间，配合 time 函数格式化"},
+	{"name": ".OccurredAt", "description": "事件发生时间，配合 time 函数格式化"},
+	{"name": ".FinishedAt", "description": "结束时间，配合 time 函数格式化"},
+	{"name": ".Errors", "description": "错误信息列表"},
+	{"name": ".AddedFiles", "description": "新增的文件列表，最多保留前 200 项"},
+	{"name": ".AddedGroups", "description": "新增媒体按目录分组，每项包含 .Folder、.Titles"},
+	{"name": ".AddedMore", "description": "超出列表上限未列出的新增数量"},
+	{"name": ".DeletedFiles", "description": "清理的文件列表，最多保留前 200 项"},
+	{"name": ".FilesTruncated", "description": "文件列表是否因超出上限被截断"},
+	{"name": ".Message", "description": "附加说明 (登录告警、授权失败原因、汇总统计等)"},
+	{"name": ".Entries", "description": "汇总通知的事件列表，每项包含 .Time、.Event、.Title"},
+}
+
+// 模板中可用的函数
+var templateFunctions = []gin.H{
+	{"name": "esc", "description": "按消息格式转义文本"},
+	{"name": "bold", "description": "加粗"},
+	{"name": "code", "description": "代码样式"},
+	{"name": "limit", "description": "取列表前 N 项: limit .Errors 5"},
+	{"name": "more", "description": "列表超出 N 项的数量: more .Errors 5"},
+	{"name": "sub", "description": "减法: sub .DeletedCount 10"},
+	{"name": "join", "description": "拼接列表: join .DeletedFiles \", \""},
+	{"name": "duration", "description": "格式化耗时"},
+	{"name": "time", "description": "格式化时间"},
+}
+
+func templateEvents() []string {
+	return append(append([]string(nil), notify.Events...), notify.EventDigest)
+}
+
+func validTemplateEvent(event string) bool {
+	_, ok := notify.DefaultTemplates[event]
+	return ok
+}
+
+// ListNotificationTemplatesHandler 返回内置默认模板、自定义模板及可用变量
+func ListNotificationTemplatesHandler(c *gin.Context) {
+	var custom []models.NotificationTemplate
+	database.DB.Order("event asc, format asc").Find(&custom)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"events":    templateEvents(),
+		"formats":   []string{notify.FormatPlain, notify.FormatMarkdown, notify.FormatHTML},
+		"defaults":  notify.DefaultTemplates,
+		"custom":    custom,
+		"variables": templateVariables,
+		"functions": templateFunctions,
+	}})
+}
+
+// SaveNotificationTemplateHandler 新建或覆盖某个事件 (及格式) 的自定义模板
+func SaveNotificationTemplateHandler(c *gin.Context) {
+	var req models.NotificationTemplate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	req.Event = strings.TrimSpace(req.Event)
+	req.Format = strings.TrimSpace(req.Format)
+	if !validTemplateEvent(req.Event) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "不支持的事件类型: " + req.Event})
+		return
+	}
+	if req.Format != "" && !notify.ValidFormat(req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "不支持的消息格式: " + req.Format})
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Body) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "模板标题和正文不能为空"})
+		return
+	}
+	format := req.Format
+	if format == "" {
+		format = notify.FormatPlain
+	}
+	if _, _, err := notify.Render(notify.Template{Title: req.Title, Body: req.Body}, format, notify.SampleEventData(req.Event)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+
+	var existing models.NotificationTemplate
+	found := database.DB.Where("event = ? AND format = ?", req.Event, req.Format).First(&existing).Error == nil
+	before := existing
+	if found {
+		existing.Title = req.Title
+		existing.Body = req.Body
+	} else {
+		existing = models.NotificationTemplate{Event: req.Event, Format: req.Format, Title: req.Title, Body: req.Body}
+	}
+	if err := database.DB.Save(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "保存模板失败: " + err.Error()})
+		return
+	}
+	if found {
+		recordAudit(c, "template.update", "template", existing.ID, existing.Event, before, existing)
+	} else {
+		recordAudit(c, "template.create", "template", existing.ID, existing.Event, nil, existing)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": existing})
+}
+
+// DeleteNotificationTemplateHandler 删除自定义模板，恢复使用默认模板
+func DeleteNotificationTemplateHandler(c *gin.Context) {
+	var tpl models.NotificationTemplate
+	if err := database.DB.First(&tpl, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "模板未找到"})
+		return
+	}
+	if err := database.DB.Delete(&tpl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "删除模板失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "template.delete", "template", tpl.ID, tpl.Event, tpl, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "已恢复默认模板"})
+}
+
+// PreviewNotificationTemplateHandler 使用示例数据渲染模板；未提供标题和正文时预览当前生效的模板
+func PreviewNotificationTemplateHandler(c *gin.Context) {
+	var req struct {
+		Event  string `json:"event" binding:"required"`
+		Format string `json:"format"`
+		Title  string `json:"title"`
+		Body   string `json:"body"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	if !validTemplateEvent(req.Event) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "不支持的事件类型: " + req.Event})
+		return
+	}
+	if req.Format == "" {
+		req.Format = notify.FormatPlain
+	}
+	if !notify.ValidFormat(req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "不支持的消息格式: " + req.Format})
+		return
+	}
+
+	tpl := core.LookupTemplate(req.Event, req.Format)
+	if req.Title != "" {
+		tpl.Title = req.Title
+	}
+	if req.Body != "" {
+		tpl.Body = req.Body
+	}
+	title, body, err := notify.Render(tpl, req.Format, notify.SampleEventData(req.Event))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"title": title, "body": body, "format": req.Format}})
+}
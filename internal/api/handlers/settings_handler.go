@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"cloudstream/internal/auth"
 	"cloudstream/internal/core"
 	"cloudstream/internal/database"
 	"cloudstream/internal/models"
+	"cloudstream/internal/pan123"
 	"cloudstream/internal/utils"
+	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -19,13 +22,20 @@ func GetUsernameHandler(c *gin.Context) {
 		notifyType = models.NotifyTypeWebhook
 	}
 
-	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
-		"username":       username,
-		"notifyType":     notifyType,
-		"webhookUrl":     user.WebhookURL,
-		"telegramToken":  user.TelegramToken,
-		"telegramChatId": user.TelegramChatID,
-	}})
+	data := gin.H{
+		"username":      username,
+		"role":          user.Role,
+		"totpEnabled":   user.TOTPEnabled,
+		"recoveryCodes": auth.RemainingRecoveryCodes(&user),
+	}
+	// 通知配置含 Bot Token 和 Webhook 地址，只返回给管理员
+	if auth.IsAdmin(c) {
+		data["notifyType"] = notifyType
+		data["webhookUrl"] = user.WebhookURL
+		data["telegramToken"] = user.TelegramToken
+		data["telegramChatId"] = user.TelegramChatID
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": data})
 }
 
 func GetSystemLogsHandler(c *gin.Context) {
@@ -37,6 +47,7 @@ func GetSystemLogsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 0, "data": logs})
 }
 
+// TestWebhookHandler 旧版通知设置页的测试接口，按旧字段构造临时渠道发送测试消息
 func TestWebhookHandler(c *gin.Context) {
 	var req map[string]string
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -44,7 +55,15 @@ func TestWebhookHandler(c *gin.Context) {
 		return
 	}
 	
-	if err := core.SendTestNotification(req); err != nil {
+	channelType := models.NotifyTypeWebhook
+	settings := map[string]string{"url": req["url"]}
+	if req["type"] == models.NotifyTypeTelegram {
+		channelType = models.NotifyTypeTelegram
+		settings = map[string]string{"token": req["token"], "chatId": req["chatId"]}
+	}
+	data, _ := json.Marshal(settings)
+
+	if err := core.SendTestNotification(channelType, string(data), ""); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "测试发送失败: " + err.Error()})
 		return
 	}
@@ -72,6 +91,7 @@ func UpdateNotificationHandler(c *gin.Context) {
 		return
 	}
 
+	before := user
 	user.NotifyType = req.NotifyType
 	user.WebhookURL = req.WebhookURL
 	user.TelegramToken = req.TelegramToken
@@ -81,10 +101,35 @@ func UpdateNotificationHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "保存失败: " + err.Error()})
 		return
 	}
+	recordAudit(c, "notification.update", "user", user.ID, user.Username, before, user)
+	syncLegacyChannel(user)
 
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "通知设置已保存"})
 }
 
+// syncLegacyChannel 旧版通知设置同步到“默认通知”渠道，保证旧页面仍然生效
+func syncLegacyChannel(user models.User) {
+	var existing models.NotificationChannel
+	found := database.DB.Where("name = ?", models.LegacyChannelName).First(&existing).Error == nil
+
+	channel, ok := database.LegacyNotificationChannel(user)
+	if !ok {
+		if found {
+			database.DB.Model(&existing).Update("enabled", false)
+		}
+		return
+	}
+	if found {
+		database.DB.Model(&existing).Updates(map[string]interface{}{
+			"type":     channel.Type,
+			"settings": channel.Settings,
+			"enabled":  true,
+		})
+		return
+	}
+	database.DB.Create(&channel)
+}
+
 // 安全设置：只负责改密码和用户名
 func UpdateCredentialsHandler(c *gin.Context) {
 	var req struct {
@@ -107,6 +152,7 @@ func UpdateCredentialsHandler(c *gin.Context) {
 		return
 	}
 
+	before := user
 	changed := false
 	if req.NewUsername != "" && req.NewUsername != user.Username {
 		var existingUser models.User
@@ -138,8 +184,76 @@ func UpdateCredentialsHandler(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "更新凭证失败: " + err.Error()})
 			return
 		}
+		auth.RevokeAllSessions(user.ID)
+		recordAudit(c, "credentials.update", "user", user.ID, user.Username, before, user)
 		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "凭证更新成功，请重新登录"})
 	} else {
 		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "未做任何修改"})
 	}
-}
\ No newline at end of file
+}
+
+// GetSystemSettingsHandler 读取全局系统设置 (单点登录、登录防护等)，OIDC 客户端密钥和入站 Webhook 令牌只返回掩码
+func GetSystemSettingsHandler(c *gin.Context) {
+	setting := database.GetSystemSetting()
+	if setting.OIDCClientSecret != "" {
+		setting.OIDCClientSecret = redactedValue
+	}
+	if setting.InboundWebhookToken != "" {
+		setting.InboundWebhookToken = redactedValue
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": setting})
+}
+
+// UpdateSystemSettingsHandler 更新全局系统设置
+func UpdateSystemSettingsHandler(c *gin.Context) {
+	setting := database.GetSystemSetting()
+	before := setting
+	if err := c.ShouldBindJSON(&setting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误"})
+		return
+	}
+	setting.ID = 1
+	// 提交回来的掩码表示未修改密钥
+	if setting.OIDCClientSecret == redactedValue {
+		setting.OIDCClientSecret = before.OIDCClientSecret
+	}
+	if setting.InboundWebhookToken == redactedValue {
+		setting.InboundWebhookToken = before.InboundWebhookToken
+	}
+	if setting.OIDCEnabled && (setting.OIDCIssuer == "" || setting.OIDCClientID == "" || setting.OIDCRedirectURL == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "启用 OIDC 时 Issuer、ClientID 和回调地址不能为空"})
+		return
+	}
+	if setting.TrustedHeaderEnabled && (setting.TrustedHeaderName == "" || setting.TrustedProxyIPs == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "启用可信头部登录时必须指定头部名称和可信代理 IP"})
+		return
+	}
+	if setting.LoginMaxFailures < 1 || setting.LoginLockoutSeconds < 1 || setting.LoginLockoutMaxSeconds < setting.LoginLockoutSeconds {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "登录锁定参数无效"})
+		return
+	}
+	if setting.MaxConcurrentTasks < 1 || setting.MaxTasksPerAccount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "任务并发参数无效"})
+		return
+	}
+	if setting.ProviderMaxAttempts < 1 || setting.ProviderMaxAttempts > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "接口最大尝试次数需在 1 到 10 之间"})
+		return
+	}
+	if err := core.ValidateTimezone(setting.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := database.DB.Save(&setting).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "保存失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "settings.update", "settings", setting.ID, "系统设置", before, setting)
+	auth.SetTrustedProxies(setting.TrustedProxyIPs)
+	core.SetQueueLimits(setting.MaxConcurrentTasks, setting.MaxTasksPerAccount)
+	pan123.SetMaxAttempts(setting.ProviderMaxAttempts)
+	if setting.Timezone != before.Timezone {
+		core.RefreshScheduler()
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "系统设置已保存"})
+}
@@ -5,6 +5,7 @@ import (
 	"cloudstream/internal/database"
 	"cloudstream/internal/models"
 	"cloudstream/internal/pan123"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -85,8 +86,12 @@ func UnifiedStreamHandler(c *gin.Context) {
 		return
 	}
 
-	client := pan123.NewClient(account)
+	client := pan123.NewClient(account).WithContext(c.Request.Context())
 	downloadURL, err := client.GetDownloadURL(identifier)
+	if errors.Is(err, pan123.ErrNotFound) {
+		c.String(http.StatusNotFound, fmt.Sprintf("File not found: %v", err))
+		return
+	}
 	if err != nil {
 		c.String(http.StatusInternalServerError, fmt.Sprintf("Failed to get link: %v", err))
 		return
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"cloudstream/internal/core"
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ListTaskDependenciesHandler 返回任务的上游依赖和下游任务
+func ListTaskDependenciesHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "无效的任务ID"})
+		return
+	}
+	var upstream, downstream []models.TaskDependency
+	database.DB.Where("task_id = ?", uint(id)).Order("id").Find(&upstream)
+	database.DB.Where("depends_on_id = ?", uint(id)).Order("id").Find(&downstream)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"dependsOn":  upstream,
+		"dependents": downstream,
+	}})
+}
+
+// CreateTaskDependencyHandler 为任务添加上游依赖
+func CreateTaskDependencyHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "无效的任务ID"})
+		return
+	}
+	var task models.Task
+	if err := database.DB.First(&task, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "找不到指定的任务"})
+		return
+	}
+	var req struct {
+		DependsOnID uint   `json:"dependsOnId" binding:"required"`
+		Condition   string `json:"condition"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": fmt.Sprintf("参数错误: %s", err.Error())})
+		return
+	}
+	if req.Condition == "" {
+		req.Condition = models.DependencyOnSuccess
+	}
+	if err := core.ValidateDependency(task.ID, req.DependsOnID, req.Condition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	var existing int64
+	database.DB.Model(&models.TaskDependency{}).Where("task_id = ? AND depends_on_id = ?", task.ID, req.DependsOnID).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "该依赖已存在"})
+		return
+	}
+	dep := models.TaskDependency{TaskID: task.ID, DependsOnID: req.DependsOnID, Condition: req.Condition}
+	if err := database.DB.Create(&dep).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "添加依赖失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "task.dependency.create", "task", task.ID, task.Name, nil, dep)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "依赖已添加", "data": dep})
+}
+
+// DeleteTaskDependencyHandler 删除任务的一条上游依赖
+func DeleteTaskDependencyHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "无效的任务ID"})
+		return
+	}
+	var dep models.TaskDependency
+	if err := database.DB.Where("task_id = ?", uint(id)).First(&dep, c.Param("depId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "找不到指定的依赖"})
+		return
+	}
+	if err := database.DB.Delete(&dep).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "删除依赖失败: " + err.Error()})
+		return
+	}
+	var task models.Task
+	database.DB.First(&task, uint(id))
+	recordAudit(c, "task.dependency.delete", "task", uint(id), task.Name, dep, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "依赖已删除"})
+}
+
+// ListTaskPipelinesHandler 返回由依赖关系组成的任务流水线
+func ListTaskPipelinesHandler(c *gin.Context) {
+	pipelines, err := core.BuildPipelines()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "读取任务依赖失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": pipelines})
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/robfig/cron/v3"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // 辅助函数：校验 Cron 表达式
@@ -24,21 +26,51 @@ func validateCron(spec string) error {
 	return nil
 }
 
+// validateTaskMediaServer 校验任务的媒体库刷新设置
+func validateTaskMediaServer(task *models.Task) error {
+	switch task.RefreshMode {
+	case "":
+		return nil
+	case models.RefreshModeFull, models.RefreshModePath:
+	default:
+		return fmt.Errorf("不支持的媒体库刷新方式: %s", task.RefreshMode)
+	}
+	var server models.MediaServer
+	if task.MediaServerID == 0 || database.DB.First(&server, task.MediaServerID).Error != nil {
+		return fmt.Errorf("请选择有效的媒体服务器")
+	}
+	return core.ValidateTaskPathMapping(*task, server)
+}
+
 func ListTasksHandler(c *gin.Context) {
 	var tasks []models.Task
 	if err := database.DB.Order("id desc").Find(&tasks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": fmt.Sprintf("获取任务列表失败: %s", err.Error())})
 		return
 	}
+	// nextRuns 指定返回的下次执行时间个数，默认 3 个
+	nextRuns := 3
+	if n, err := strconv.Atoi(c.Query("nextRuns")); err == nil && n >= 0 {
+		nextRuns = n
+	}
+	global := core.SchedulerLocation()
 	type TaskWithStatus struct {
 		models.Task
-		IsRunning bool `json:"IsRunning"`
+		IsRunning         bool        `json:"IsRunning"`
+		IsQueued          bool        `json:"IsQueued"`
+		EffectiveTimezone string      `json:"EffectiveTimezone"`
+		NextRuns          []time.Time `json:"NextRuns"`
 	}
 	tasksWithStatus := make([]TaskWithStatus, len(tasks))
 	for i, task := range tasks {
 		tasksWithStatus[i] = TaskWithStatus{
-			Task:      task,
-			IsRunning: core.IsTaskRunning(task.ID),
+			Task:              task,
+			IsRunning:         core.IsTaskRunning(task.ID),
+			IsQueued:          core.IsTaskQueued(task.ID),
+			EffectiveTimezone: core.TaskLocation(task, global).String(),
+		}
+		if task.Enabled {
+			tasksWithStatus[i].NextRuns = core.NextRunTimes(task, global, nextRuns)
 		}
 	}
 	c.JSON(http.StatusOK, gin.H{"code": 0, "data": tasksWithStatus})
@@ -56,11 +88,20 @@ func CreateTaskHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
+	if err := core.ValidateTimezone(task.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := validateTaskMediaServer(&task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
 	if err := database.DB.Create(&task).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "创建任务失败: " + err.Error()})
 		return
 	}
-	core.RefreshScheduler()
+	recordAudit(c, "task.create", "task", task.ID, task.Name, nil, task)
+	core.RefreshTask(task.ID)
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "任务创建成功", "data": task})
 }
 
@@ -76,6 +117,7 @@ func UpdateTaskHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "找不到指定的任务"})
 		return
 	}
+	before := task
 	if err := c.ShouldBindJSON(&task); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": fmt.Sprintf("参数错误: %s", err.Error())})
 		return
@@ -84,11 +126,25 @@ func UpdateTaskHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
+	if err := core.ValidateTimezone(task.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := validateTaskMediaServer(&task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
 	if err := database.DB.Save(&task).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "更新任务失败: " + err.Error()})
 		return
 	}
-	core.RefreshScheduler()
+	recordAudit(c, "task.update", "task", task.ID, task.Name, before, task)
+	if task.SourceFolderID != before.SourceFolderID || task.LocalPath != before.LocalPath || task.AccountID != before.AccountID {
+		// 先丢弃旧源目录的运行结果，再清理断点
+		core.DiscardTaskRun(task.ID)
+		core.ClearCheckpoint(task.ID)
+	}
+	core.RefreshTask(task.ID)
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "任务更新成功", "data": task})
 }
 
@@ -100,13 +156,22 @@ func DeleteTaskHandler(c *gin.Context) {
 		return
 	}
 	taskID := uint(id)
-	core.StopTask(taskID)
+	var task models.Task
+	if err := database.DB.First(&task, taskID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "找不到指定的任务"})
+		return
+	}
+	core.DiscardTaskRun(taskID)
+	core.CancelQueuedTask(taskID)
 	if err := database.DB.Unscoped().Delete(&models.Task{}, taskID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": fmt.Sprintf("删除任务失败: %s", err.Error())})
 		return
 	}
 	database.DB.Unscoped().Where("task_id = ?", taskID).Delete(&models.TaskFile{})
-	core.RefreshScheduler()
+	core.ClearCheckpoint(taskID)
+	core.DeleteTaskDependencies(taskID)
+	recordAudit(c, "task.delete", "task", taskID, task.Name, task, nil)
+	core.RefreshTask(taskID)
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "任务及关联记录已删除"})
 }
 
@@ -117,13 +182,114 @@ func ExecuteTaskHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "找不到指定的任务"})
 		return
 	}
+	// fresh=true 时丢弃断点，从头完整扫描
+	if c.Query("fresh") == "true" && !core.IsTaskRunning(task.ID) && !core.IsTaskQueued(task.ID) {
+		core.ClearCheckpoint(task.ID)
+	}
 	if core.RunManualTask(task) {
+		recordAudit(c, "task.run", "task", task.ID, task.Name, nil, nil)
+		if core.IsTaskQueued(task.ID) {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": fmt.Sprintf("并发任务数已满，任务 '%s' 已加入执行队列。", task.Name)})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"code": 0, "message": fmt.Sprintf("任务 '%s' 已开始在后台执行。", task.Name)})
 	} else {
-		c.JSON(http.StatusConflict, gin.H{"code": 1, "message": fmt.Sprintf("任务 '%s' 已在运行中，请勿重复执行。", task.Name)})
+		c.JSON(http.StatusConflict, gin.H{"code": 1, "message": fmt.Sprintf("任务 '%s' 已在运行或排队中，请勿重复执行。", task.Name)})
 	}
 }
 
+// ExecuteSubtreeHandler 只扫描任务源目录下的某个子目录 (相对路径或云盘目录 ID)，
+// 结果写入 LocalPath 下对应的子目录，只更新该子目录范围内的文件记录
+func ExecuteSubtreeHandler(c *gin.Context) {
+	var task models.Task
+	if err := database.DB.First(&task, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "找不到指定的任务"})
+		return
+	}
+	var req struct {
+		Path       string `json:"path"`
+		FolderID   string `json:"folderId"`
+		SyncDelete *bool  `json:"syncDelete"` // 未指定时沿用任务的同步删除设置
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误: " + err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Path) == "" && strings.TrimSpace(req.FolderID) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "path 和 folderId 至少需要提供一个"})
+		return
+	}
+	syncDelete := true
+	if req.SyncDelete != nil {
+		syncDelete = *req.SyncDelete
+	}
+	scope, err := core.ResolveTaskScope(task, strings.TrimSpace(req.FolderID), req.Path, syncDelete)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "解析子目录失败: " + err.Error()})
+		return
+	}
+	if !core.RunSubtreeScan(task, scope, core.RunSourceManual) {
+		c.JSON(http.StatusConflict, gin.H{"code": 1, "message": fmt.Sprintf("任务 '%s' 已在运行或排队中，请勿重复执行。", task.Name)})
+		return
+	}
+	recordAudit(c, "task.run_subtree", "task", task.ID, task.Name, nil, gin.H{"subPath": scope.RelPath, "folderId": scope.FolderID})
+	message := fmt.Sprintf("任务 '%s' 的子目录 '%s' 已开始在后台扫描。", task.Name, scope.RelPath)
+	if core.IsTaskQueued(task.ID) {
+		message = fmt.Sprintf("并发任务数已满，任务 '%s' 的子目录 '%s' 已加入执行队列。", task.Name, scope.RelPath)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": message,
+		"data": gin.H{"subPath": scope.RelPath, "folderId": scope.FolderID, "syncDelete": task.SyncDelete && scope.SyncDelete}})
+}
+
+// GetTaskCheckpointHandler 返回任务各扫描范围 (完整扫描及子目录扫描) 的断点，包含已完成和失败的目录
+func GetTaskCheckpointHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "无效的任务ID"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": core.GetCheckpoints(uint(id))})
+}
+
+// DeleteTaskCheckpointHandler 丢弃任务的扫描断点，下次执行将完整扫描
+func DeleteTaskCheckpointHandler(c *gin.Context) {
+	var task models.Task
+	if err := database.DB.First(&task, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "找不到指定的任务"})
+		return
+	}
+	core.ClearCheckpoint(task.ID)
+	recordAudit(c, "task.checkpoint_clear", "task", task.ID, task.Name, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "断点已清除"})
+}
+
+// ListTaskQueueHandler 返回正在运行和排队中的任务
+func ListTaskQueueHandler(c *gin.Context) {
+	setting := database.GetSystemSetting()
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"entries":            core.QueueSnapshot(),
+		"maxConcurrentTasks": setting.MaxConcurrentTasks,
+		"maxTasksPerAccount": setting.MaxTasksPerAccount,
+	}})
+}
+
+// CancelQueuedTaskHandler 将尚未开始的任务移出执行队列
+func CancelQueuedTaskHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "无效的任务ID"})
+		return
+	}
+	if !core.CancelQueuedTask(uint(id)) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "任务不在排队中"})
+		return
+	}
+	var task models.Task
+	database.DB.First(&task, uint(id))
+	recordAudit(c, "task.dequeue", "task", uint(id), task.Name, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "已取消排队"})
+}
+
 func StopTaskHandler(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
@@ -131,6 +297,9 @@ func StopTaskHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "无效的任务ID"})
 		return
 	}
+	var task models.Task
+	database.DB.First(&task, uint(id))
 	core.StopTask(uint(id))
+	recordAudit(c, "task.stop", "task", uint(id), task.Name, nil, nil)
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": fmt.Sprintf("已发送停止信号给任务 #%d。", id)})
 }
\ No newline at end of file
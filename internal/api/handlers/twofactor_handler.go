@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"cloudstream/internal/auth"
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"cloudstream/internal/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func currentUser(c *gin.Context) (*models.User, bool) {
+	username, _ := c.Get("username")
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "用户未找到"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// SetupTOTPHandler 生成新的 TOTP 密钥（尚未启用），返回供扫码的 otpauth 地址
+func SetupTOTPHandler(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"code": 1, "message": "两步验证已启用，如需重新绑定请先关闭"})
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "生成密钥失败"})
+		return
+	}
+	sealed, err := auth.SealTOTPSecret(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "加密密钥失败"})
+		return
+	}
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret":    sealed,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "保存失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"secret": secret,
+		"uri":    auth.TOTPProvisioningURI(user.Username, secret),
+	}})
+}
+
+// EnableTOTPHandler 校验首个动态码后正式启用两步验证，并下发恢复码
+func EnableTOTPHandler(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "验证码不能为空"})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"code": 1, "message": "两步验证已启用"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "请先生成密钥"})
+		return
+	}
+	if auth.CheckTOTPLocked(c, user.Username) {
+		return
+	}
+	if !auth.VerifyUserTOTP(user, req.Code) {
+		auth.RecordTOTPFailure(c, user.Username)
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "验证码错误，请检查设备时间"})
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "生成恢复码失败"})
+		return
+	}
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_enabled":        true,
+		"totp_recovery_codes": hashes,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "保存失败: " + err.Error()})
+		return
+	}
+
+	recordAudit(c, "2fa.enable", "user", user.ID, user.Username, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "两步验证已启用，请妥善保存恢复码", "data": gin.H{"recoveryCodes": codes}})
+}
+
+// DisableTOTPHandler 需要当前密码及动态码(或恢复码)才能关闭两步验证
+func DisableTOTPHandler(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"currentPassword" binding:"required"`
+		Code            string `json:"code"`
+		RecoveryCode    string `json:"recoveryCode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误"})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "两步验证未启用"})
+		return
+	}
+	if auth.CheckTOTPLocked(c, user.Username) {
+		return
+	}
+	if !utils.CheckPasswordHash(req.CurrentPassword, user.PasswordHash) {
+		auth.RecordTOTPFailure(c, user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "message": "当前密码不正确"})
+		return
+	}
+	if !auth.VerifyUserTOTP(user, req.Code) && (req.RecoveryCode == "" || !auth.ConsumeRecoveryCode(user, req.RecoveryCode)) {
+		auth.RecordTOTPFailure(c, user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "message": "验证码或恢复码错误"})
+		return
+	}
+
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_enabled":        false,
+		"totp_secret":         "",
+		"totp_recovery_codes": "",
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "保存失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "2fa.disable", "user", user.ID, user.Username, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodesHandler 校验动态码后重新生成恢复码，旧恢复码全部作废
+func RegenerateRecoveryCodesHandler(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "验证码不能为空"})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "两步验证未启用"})
+		return
+	}
+	if auth.CheckTOTPLocked(c, user.Username) {
+		return
+	}
+	if !auth.VerifyUserTOTP(user, req.Code) {
+		auth.RecordTOTPFailure(c, user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "message": "验证码错误"})
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "生成恢复码失败"})
+		return
+	}
+	if err := database.DB.Model(user).Update("totp_recovery_codes", hashes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "保存失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, "2fa.recovery_codes", "user", user.ID, user.Username, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"recoveryCodes": codes}})
+}
@@ -15,6 +15,8 @@ func InitRouter() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
+	// 客户端 IP 统一由 auth.ClientIP 按系统设置中的可信代理解析，这里不信任任何转发头
+	r.SetTrustedProxies(nil)
 
 	// 1. 性能优化：开启 Gzip 压缩 (大幅减少 JSON 体积)
 	r.Use(gzip.Gzip(gzip.DefaultCompression))
@@ -24,6 +26,17 @@ func InitRouter() *gin.Engine {
 		// 公开接口
 		v1.Match([]string{"GET", "HEAD"}, "/stream/s/*path", handlers.UnifiedStreamHandler)
 		v1.POST("/login", auth.LoginRateLimiter(), auth.LoginHandler)
+		v1.POST("/login/2fa", auth.LoginRateLimiter(), auth.LoginTOTPHandler)
+		v1.POST("/token/refresh", auth.LoginRateLimiter(), auth.RefreshTokenHandler)
+
+		// 单点登录
+		v1.GET("/sso/config", auth.SSOConfigHandler)
+		v1.GET("/sso/header", auth.TrustedHeaderLoginHandler)
+		v1.GET("/oidc/login", auth.OIDCLoginHandler)
+		v1.GET("/oidc/callback", auth.OIDCCallbackHandler)
+
+		// 外部触发扫描，使用系统设置中的令牌鉴权
+		v1.POST("/hooks/scan", handlers.InboundScanHookHandler)
 
 		// 鉴权接口
 		authorized := v1.Group("/")
@@ -31,36 +44,104 @@ func InitRouter() *gin.Engine {
 		{
 			// 2. 安全优化：新增主动登出接口
 			authorized.POST("/logout", handlers.LogoutHandler)
+			authorized.POST("/logout/all", handlers.LogoutAllHandler)
+			authorized.GET("/sessions", handlers.ListSessionsHandler)
+			authorized.DELETE("/sessions/:id", handlers.RevokeSessionHandler)
 
 			authorized.GET("/username", handlers.GetUsernameHandler)
-			authorized.GET("/logs", handlers.GetSystemLogsHandler)
-			
-			authorized.POST("/webhook/test", handlers.TestWebhookHandler)
-			authorized.POST("/notifications", handlers.UpdateNotificationHandler)
 			authorized.POST("/update_credentials", handlers.UpdateCredentialsHandler)
-			authorized.POST("/accounts/test", handlers.TestAccountConnectionHandler)
 
-			accounts := authorized.Group("/accounts")
+			twoFactor := authorized.Group("/2fa")
 			{
-				accounts.GET("", handlers.ListAccountsHandler)
-				accounts.POST("", handlers.CreateAccountHandler)
-				accounts.PUT("/:id", handlers.UpdateAccountHandler)
-				accounts.DELETE("/:id", handlers.DeleteAccountHandler)
+				twoFactor.POST("/setup", handlers.SetupTOTPHandler)
+				twoFactor.POST("/enable", handlers.EnableTOTPHandler)
+				twoFactor.POST("/disable", handlers.DisableTOTPHandler)
+				twoFactor.POST("/recovery_codes", handlers.RegenerateRecoveryCodesHandler)
 			}
 
-			tasks := authorized.Group("/tasks")
-			{
-				tasks.GET("", handlers.ListTasksHandler)
-				tasks.POST("", handlers.CreateTaskHandler)
-				tasks.PUT("/:id", handlers.UpdateTaskHandler)
-				tasks.DELETE("/:id", handlers.DeleteTaskHandler)
-				tasks.POST("/:id/run", handlers.ExecuteTaskHandler)
-				tasks.POST("/:id/stop", handlers.StopTaskHandler)
-			}
+			authorized.GET("/accounts", handlers.ListAccountsHandler)
+			authorized.GET("/tasks", handlers.ListTasksHandler)
+			authorized.GET("/tasks/queue", handlers.ListTaskQueueHandler)
+			authorized.GET("/tasks/:id/checkpoint", handlers.GetTaskCheckpointHandler)
+			authorized.GET("/tasks/pipelines", handlers.ListTaskPipelinesHandler)
+			authorized.GET("/tasks/:id/dependencies", handlers.ListTaskDependenciesHandler)
+			authorized.GET("/cloud/files", handlers.FileBrowserHandler)
 
-			cloud := authorized.Group("/cloud")
+			// 以下接口仅管理员可用
+			admin := authorized.Group("/")
+			admin.Use(auth.RequireAdmin())
 			{
-				cloud.GET("/files", handlers.FileBrowserHandler)
+				admin.GET("/logs", handlers.GetSystemLogsHandler)
+
+				admin.POST("/webhook/test", handlers.TestWebhookHandler)
+				admin.POST("/notifications", handlers.UpdateNotificationHandler)
+				admin.POST("/accounts/test", handlers.TestAccountConnectionHandler)
+
+				admin.GET("/audit_logs", handlers.ListAuditLogsHandler)
+
+				channels := admin.Group("/notification_channels")
+				{
+					channels.GET("", handlers.ListNotificationChannelsHandler)
+					channels.GET("/types", handlers.ListNotificationTypesHandler)
+					channels.POST("", handlers.CreateNotificationChannelHandler)
+					channels.POST("/test", handlers.TestNotificationConfigHandler)
+					channels.POST("/test/:type", handlers.TestNotificationTypeHandler)
+					channels.PUT("/:id", handlers.UpdateNotificationChannelHandler)
+					channels.DELETE("/:id", handlers.DeleteNotificationChannelHandler)
+					channels.POST("/:id/test", handlers.TestNotificationChannelHandler)
+				}
+
+				templates := admin.Group("/notification_templates")
+				{
+					templates.GET("", handlers.ListNotificationTemplatesHandler)
+					templates.PUT("", handlers.SaveNotificationTemplateHandler)
+					templates.POST("/preview", handlers.PreviewNotificationTemplateHandler)
+					templates.DELETE("/:id", handlers.DeleteNotificationTemplateHandler)
+				}
+
+				deliveries := admin.Group("/notification_deliveries")
+				{
+					deliveries.GET("", handlers.ListNotificationDeliveriesHandler)
+					deliveries.POST("/retry", handlers.RetryDeadNotificationDeliveriesHandler)
+					deliveries.POST("/:id/retry", handlers.RetryNotificationDeliveryHandler)
+					deliveries.DELETE("/:id", handlers.DeleteNotificationDeliveryHandler)
+				}
+
+				mediaServers := admin.Group("/media_servers")
+				{
+					mediaServers.GET("", handlers.ListMediaServersHandler)
+					mediaServers.GET("/types", handlers.ListMediaServerTypesHandler)
+					mediaServers.POST("", handlers.CreateMediaServerHandler)
+					mediaServers.POST("/test", handlers.TestMediaServerConfigHandler)
+					mediaServers.PUT("/:id", handlers.UpdateMediaServerHandler)
+					mediaServers.DELETE("/:id", handlers.DeleteMediaServerHandler)
+					mediaServers.POST("/:id/test", handlers.TestMediaServerHandler)
+					mediaServers.POST("/:id/refresh", handlers.RefreshMediaServerHandler)
+				}
+
+				admin.GET("/settings", handlers.GetSystemSettingsHandler)
+				admin.PUT("/settings", handlers.UpdateSystemSettingsHandler)
+
+				accounts := admin.Group("/accounts")
+				{
+					accounts.POST("", handlers.CreateAccountHandler)
+					accounts.PUT("/:id", handlers.UpdateAccountHandler)
+					accounts.DELETE("/:id", handlers.DeleteAccountHandler)
+				}
+
+				tasks := admin.Group("/tasks")
+				{
+					tasks.POST("", handlers.CreateTaskHandler)
+					tasks.PUT("/:id", handlers.UpdateTaskHandler)
+					tasks.DELETE("/:id", handlers.DeleteTaskHandler)
+					tasks.POST("/:id/run", handlers.ExecuteTaskHandler)
+					tasks.POST("/:id/scan", handlers.ExecuteSubtreeHandler)
+					tasks.POST("/:id/stop", handlers.StopTaskHandler)
+					tasks.DELETE("/queue/:id", handlers.CancelQueuedTaskHandler)
+					tasks.DELETE("/:id/checkpoint", handlers.DeleteTaskCheckpointHandler)
+					tasks.POST("/:id/dependencies", handlers.CreateTaskDependencyHandler)
+					tasks.DELETE("/:id/dependencies/:depId", handlers.DeleteTaskDependencyHandler)
+				}
 			}
 		}
 	}
@@ -84,4 +165,4 @@ func InitRouter() *gin.Engine {
 	})
 
 	return r
-}
\ No newline at end of file
+}
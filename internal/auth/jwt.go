@@ -60,37 +60,45 @@ func LoginHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "用户名或密码不能为空"})
 		return
 	}
+	if checkUserLocked(c, req.Username) {
+		return
+	}
 	var user models.User
 	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
+		recordLoginFailure(c, req.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 		return
 	}
 	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+		recordLoginFailure(c, req.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 		return
 	}
-	tokenString, err := generateToken(user.Username, user.TokenVersion)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法生成 Token"})
+	// 开启两步验证时，先返回短期挑战凭证，由 /login/2fa 完成登录
+	if user.TOTPEnabled {
+		challenge, err := generateChallengeToken(user.Username, user.TokenVersion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "无法生成 Token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"twoFactorRequired": true, "challengeToken": challenge})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
-}
-
-func generateToken(username string, tokenVersion int) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": username,
-		"version":  tokenVersion,
-		"exp":      time.Now().Add(7 * 24 * time.Hour).Unix(),
-		"iat":      time.Now().Unix(),
-	})
-	return token.SignedString(jwtSecret)
+	recordLoginSuccess(c, user.Username)
+	respondWithToken(c, &user)
 }
 
 func JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
+			// 来自可信反向代理的请求可直接通过头部认证
+			if user, ok := userFromTrustedHeader(c); ok {
+				c.Set("username", user.Username)
+				c.Set("role", user.Role)
+				c.Next()
+				return
+			}
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "请求未包含 Token"})
 			return
 		}
@@ -111,6 +119,10 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+			if purpose, _ := claims["purpose"].(string); purpose != "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token 无效"})
+				return
+			}
 			username, _ := claims["username"].(string)
 			version, _ := claims["version"].(float64)
 			var user models.User
@@ -122,7 +134,14 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token 已失效，请重新登录"})
 				return
 			}
+			sid, _ := claims["sid"].(float64)
+			if err := validateSession(c, uint(sid), &user); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token 已失效，请重新登录"})
+				return
+			}
+			c.Set("sessionID", uint(sid))
 			c.Set("username", username)
+			c.Set("role", user.Role)
 			c.Next()
 		} else {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token 无效"})
@@ -130,6 +149,24 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// IsAdmin 当前请求的用户是否为管理员，须在 JWTAuthMiddleware 之后使用
+func IsAdmin(c *gin.Context) bool {
+	role, _ := c.Get("role")
+	r, _ := role.(string)
+	return r == models.RoleAdmin
+}
+
+// RequireAdmin 仅允许管理员角色访问，须在 JWTAuthMiddleware 之后使用
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": 1, "message": "当前用户没有执行此操作的权限"})
+			return
+		}
+		c.Next()
+	}
+}
+
 // SignStreamURL 生成包含 随机盐值(Salt) 的签名
 func SignStreamURL(accountID uint, realIdentity string) (string, error) {
 	if len(jwtSecret) == 0 {
@@ -200,4 +237,4 @@ func VerifyStreamSign(signStr string) (uint, string, error) {
 	}
 
 	return uint(accID), realIdentity, nil
-}
\ No newline at end of file
+}
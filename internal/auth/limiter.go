@@ -1,50 +1,244 @@
 package auth
 
 import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm/clause"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// 简单的内存限流器
+// 登录失败记录在内存中维护，并同步写入数据库，重启后锁定依然有效
 var (
-	ipStore = make(map[string]*rateLimiter)
-	mu      sync.Mutex
+	loginEntries = make(map[string]*loginEntry)
+	mu           sync.Mutex
+	guardOnce    sync.Once
+
+	// LoginAlertFunc 失败次数达到阈值时调用，由 main 注入通知实现 (避免 auth 依赖 core)
+	LoginAlertFunc func(message string)
+
+	// trustedProxies 缓存可信代理列表，避免每个请求都读取系统设置
+	trustedProxies atomic.Pointer[string]
+)
+
+const (
+	loginEntryTTL   = 24 * time.Hour // 超过该时间无失败记录且未锁定的条目会被清理
+	janitorInterval = 10 * time.Minute
 )
 
-type rateLimiter struct {
-	count    int
-	lastTime time.Time
+type loginEntry struct {
+	failures      int
+	lockedUntil   time.Time
+	lastFailureAt time.Time
 }
 
-// LoginRateLimiter 每分钟只允许尝试 5 次登录
-func LoginRateLimiter() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
+// InitLoginGuard 从数据库恢复锁定状态，并启动过期条目清理协程
+func InitLoginGuard() {
+	guardOnce.Do(func() {
+		var records []models.LoginLockout
+		if err := database.DB.Where("last_failure_at > ? OR locked_until > ?", time.Now().Add(-loginEntryTTL), time.Now()).Find(&records).Error; err != nil {
+			log.Error().Err(err).Msg("加载登录锁定记录失败")
+		}
 		mu.Lock()
-		defer mu.Unlock()
+		for _, r := range records {
+			loginEntries[r.Key] = &loginEntry{failures: r.Failures, lockedUntil: r.LockedUntil, lastFailureAt: r.LastFailureAt}
+		}
+		mu.Unlock()
+		if len(records) > 0 {
+			log.Info().Int("count", len(records)).Msg("已恢复登录失败记录")
+		}
+
+		go func() {
+			ticker := time.NewTicker(janitorInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				evictStaleEntries()
+			}
+		}()
+	})
+}
 
-		limiter, exists := ipStore[ip]
-		if !exists {
-			limiter = &rateLimiter{count: 0, lastTime: time.Now()}
-			ipStore[ip] = limiter
+func evictStaleEntries() {
+	now := time.Now()
+	cutoff := now.Add(-loginEntryTTL)
+	mu.Lock()
+	for key, e := range loginEntries {
+		if e.lastFailureAt.Before(cutoff) && now.After(e.lockedUntil) {
+			delete(loginEntries, key)
 		}
+	}
+	mu.Unlock()
+	database.DB.Where("last_failure_at < ? AND locked_until < ?", cutoff, now).Delete(&models.LoginLockout{})
+}
 
-		// 如果距离上次重置超过1分钟，重置计数器
-		if time.Since(limiter.lastTime) > time.Minute {
-			limiter.count = 0
-			limiter.lastTime = time.Now()
+// ClientIP 仅在请求来自可信代理时才采信 X-Forwarded-For / X-Real-IP
+func ClientIP(c *gin.Context) string {
+	remote := c.RemoteIP()
+	trusted := trustedProxyList()
+	if trusted == "" || !ipAllowed(remote, trusted) {
+		return remote
+	}
+	// 从右向左找到第一个非可信代理的地址
+	if xff := c.GetHeader("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if !ipAllowed(hop, trusted) {
+				return hop
+			}
 		}
+	}
+	if realIP := strings.TrimSpace(c.GetHeader("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return remote
+}
+
+func trustedProxyList() string {
+	if p := trustedProxies.Load(); p != nil {
+		return *p
+	}
+	list := database.GetSystemSetting().TrustedProxyIPs
+	trustedProxies.Store(&list)
+	return list
+}
 
-		limiter.count++
+// SetTrustedProxies 系统设置保存后刷新可信代理缓存
+func SetTrustedProxies(list string) {
+	trustedProxies.Store(&list)
+}
 
-		if limiter.count > 5 {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "尝试次数过多，请 1 分钟后再试"})
-			c.Abort()
-			return
+// lockRemaining 返回指定 key 剩余的锁定时间
+func lockRemaining(key string) time.Duration {
+	mu.Lock()
+	defer mu.Unlock()
+	if e, ok := loginEntries[key]; ok {
+		if d := time.Until(e.lockedUntil); d > 0 {
+			return d
 		}
+	}
+	return 0
+}
 
+func lockoutDuration(setting models.SystemSetting, failures int) time.Duration {
+	maxFailures := setting.LoginMaxFailures
+	if maxFailures < 1 {
+		maxFailures = 5
+	}
+	if failures < maxFailures {
+		return 0
+	}
+	base := time.Duration(setting.LoginLockoutSeconds) * time.Second
+	if base <= 0 {
+		base = time.Minute
+	}
+	limit := time.Duration(setting.LoginLockoutMaxSeconds) * time.Second
+	if limit < base {
+		limit = base
+	}
+	d := base
+	for i := maxFailures; i < failures && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+func registerFailure(setting models.SystemSetting, key string) (int, time.Duration) {
+	now := time.Now()
+	mu.Lock()
+	e, ok := loginEntries[key]
+	if !ok {
+		e = &loginEntry{}
+		loginEntries[key] = e
+	}
+	// 长时间没有失败记录则重新计数
+	if now.Sub(e.lastFailureAt) > loginEntryTTL {
+		e.failures = 0
+	}
+	e.failures++
+	e.lastFailureAt = now
+	lock := lockoutDuration(setting, e.failures)
+	if lock > 0 {
+		e.lockedUntil = now.Add(lock)
+	}
+	record := models.LoginLockout{Key: key, Failures: e.failures, LockedUntil: e.lockedUntil, LastFailureAt: e.lastFailureAt}
+	failures := e.failures
+	mu.Unlock()
+
+	database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"failures", "locked_until", "last_failure_at"}),
+	}).Create(&record)
+	return failures, lock
+}
+
+// recordLoginFailure 同时按 IP 与用户名记录一次失败 (密码错误或动态码错误)
+func recordLoginFailure(c *gin.Context, username string) {
+	setting := database.GetSystemSetting()
+	ip := ClientIP(c)
+
+	ipFailures, ipLock := registerFailure(setting, "ip:"+ip)
+	userFailures, userLock := 0, time.Duration(0)
+	if username != "" {
+		userFailures, userLock = registerFailure(setting, "user:"+username)
+	}
+
+	if ipLock > 0 || userLock > 0 {
+		log.Warn().Str("ip", ip).Str("用户", username).Int("IP失败次数", ipFailures).Int("用户失败次数", userFailures).Msg("登录失败次数过多，已临时锁定")
+	}
+
+	threshold := setting.LoginAlertThreshold
+	if threshold > 0 && LoginAlertFunc != nil && (ipFailures%threshold == 0 || (userFailures > 0 && userFailures%threshold == 0)) {
+		LoginAlertFunc(fmt.Sprintf("检测到多次登录失败\nIP: %s (累计 %d 次)\n用户名: %s (累计 %d 次)", ip, ipFailures, username, userFailures))
+	}
+}
+
+// recordLoginSuccess 登录成功后清除对应 IP 与用户名的失败记录
+func recordLoginSuccess(c *gin.Context, username string) {
+	keys := []string{"ip:" + ClientIP(c), "user:" + username}
+	mu.Lock()
+	for _, k := range keys {
+		delete(loginEntries, k)
+	}
+	mu.Unlock()
+	database.DB.Where("key IN ?", keys).Delete(&models.LoginLockout{})
+}
+
+func rejectLocked(c *gin.Context, remaining time.Duration) {
+	seconds := int(remaining.Seconds()) + 1
+	c.Header("Retry-After", fmt.Sprintf("%d", seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("尝试次数过多，请 %d 秒后再试", seconds)})
+}
+
+// checkUserLocked 按用户名检查锁定，已锁定时直接写入响应并返回 true
+func checkUserLocked(c *gin.Context, username string) bool {
+	if remaining := lockRemaining("user:" + username); remaining > 0 {
+		rejectLocked(c, remaining)
+		return true
+	}
+	return false
+}
+
+// LoginRateLimiter 拦截已被锁定 IP 的登录请求，失败计数由登录处理函数负责
+func LoginRateLimiter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if remaining := lockRemaining("ip:" + ClientIP(c)); remaining > 0 {
+			rejectLocked(c, remaining)
+			return
+		}
 		c.Next()
 	}
-}
\ No newline at end of file
+}
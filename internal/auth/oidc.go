@@ -0,0 +1,378 @@
+package auth
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var oidcHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcPending struct {
+	Verifier  string
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+var (
+	oidcStates   = make(map[string]oidcPending)
+	oidcStatesMu sync.Mutex
+
+	jwksCache   = make(map[string]map[string]interface{}) // jwks_uri -> kid -> 公钥
+	jwksCacheMu sync.Mutex
+)
+
+func randomURLString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func fetchJSON(rawURL string, out interface{}) error {
+	resp, err := oidcHTTPClient.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func discoverOIDC(issuer string) (*oidcDiscovery, error) {
+	var doc oidcDiscovery
+	wellKnown := strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+	if err := fetchJSON(wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 发现文档失败: %w", err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != strings.TrimRight(issuer, "/") {
+		return nil, fmt.Errorf("发现文档 issuer 不匹配: %s", doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("发现文档缺少必要的端点")
+	}
+	return &doc, nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+}
+
+// lookupJWK 从缓存查找公钥，找不到时重新拉取 JWKS (应对密钥轮换)
+func lookupJWK(jwksURI, kid string) (interface{}, error) {
+	jwksCacheMu.Lock()
+	defer jwksCacheMu.Unlock()
+
+	if keys, ok := jwksCache[jwksURI]; ok {
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := fetchJSON(jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("获取 JWKS 失败: %w", err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	jwksCache[jwksURI] = keys
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// 只有一把密钥且 id_token 未指定 kid 时直接使用
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("JWKS 中找不到 kid=%s 的公钥", kid)
+}
+
+// OIDCLoginHandler 发起授权码 + PKCE 登录，重定向到认证服务器
+func OIDCLoginHandler(c *gin.Context) {
+	setting := database.GetSystemSetting()
+	if !setting.OIDCEnabled || setting.OIDCIssuer == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用 OIDC 登录"})
+		return
+	}
+	doc, err := discoverOIDC(setting.OIDCIssuer)
+	if err != nil {
+		log.Error().Err(err).Msg("OIDC 登录失败")
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	state, err1 := randomURLString(24)
+	nonce, err2 := randomURLString(24)
+	verifier, err3 := randomURLString(48)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成登录参数失败"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	oidcStatesMu.Lock()
+	now := time.Now()
+	for k, v := range oidcStates {
+		if now.After(v.ExpiresAt) {
+			delete(oidcStates, k)
+		}
+	}
+	oidcStates[state] = oidcPending{Verifier: verifier, Nonce: nonce, ExpiresAt: now.Add(oidcStateTTL)}
+	oidcStatesMu.Unlock()
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", setting.OIDCClientID)
+	q.Set("redirect_uri", setting.OIDCRedirectURL)
+	q.Set("scope", setting.OIDCScopes)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	c.Redirect(http.StatusFound, doc.AuthorizationEndpoint+sep+q.Encode())
+}
+
+func exchangeOIDCCode(setting models.SystemSetting, doc *oidcDiscovery, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", setting.OIDCRedirectURL)
+	form.Set("client_id", setting.OIDCClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if setting.OIDCClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(setting.OIDCClientID), url.QueryEscape(setting.OIDCClientSecret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求 Token 端点失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("解析 Token 响应失败: %w", err)
+	}
+	if tokenResp.Error != "" {
+		return "", fmt.Errorf("%s: %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return "", fmt.Errorf("Token 响应中缺少 id_token")
+	}
+	return tokenResp.IDToken, nil
+}
+
+func verifyIDToken(setting models.SystemSetting, doc *oidcDiscovery, rawIDToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodRSAPSS:
+		default:
+			return nil, fmt.Errorf("非预期的签名方法: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return lookupJWK(doc.JWKSURI, kid)
+	}, jwt.WithIssuer(doc.Issuer), jwt.WithAudience(setting.OIDCClientID), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("id_token 校验失败: %w", err)
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("id_token nonce 不匹配")
+	}
+	return claims, nil
+}
+
+func claimStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return strings.Split(t, ",")
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// OIDCCallbackHandler 处理认证服务器回调，校验 id_token 后签发本地 Token
+// 成功后重定向到 /login#token=...&refreshToken=...，由前端读取并保存
+func OIDCCallbackHandler(c *gin.Context) {
+	fail := func(msg string) {
+		c.Redirect(http.StatusFound, "/login#error="+url.QueryEscape(msg))
+	}
+
+	if errParam := c.Query("error"); errParam != "" {
+		fail(errParam + ": " + c.Query("error_description"))
+		return
+	}
+
+	state := c.Query("state")
+	oidcStatesMu.Lock()
+	pending, ok := oidcStates[state]
+	delete(oidcStates, state)
+	oidcStatesMu.Unlock()
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		fail("登录状态无效或已过期")
+		return
+	}
+
+	setting := database.GetSystemSetting()
+	if !setting.OIDCEnabled {
+		fail("未启用 OIDC 登录")
+		return
+	}
+	doc, err := discoverOIDC(setting.OIDCIssuer)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	rawIDToken, err := exchangeOIDCCode(setting, doc, c.Query("code"), pending.Verifier)
+	if err != nil {
+		log.Error().Err(err).Msg("OIDC 授权码换取失败")
+		fail(err.Error())
+		return
+	}
+	claims, err := verifyIDToken(setting, doc, rawIDToken, pending.Nonce)
+	if err != nil {
+		log.Error().Err(err).Msg("OIDC 登录失败")
+		fail(err.Error())
+		return
+	}
+
+	subject, _ := claims["sub"].(string)
+	username, _ := claims[setting.OIDCUsernameClaim].(string)
+	if username == "" {
+		username, _ = claims["email"].(string)
+	}
+	user, err := resolveExternalUser(setting, ExternalIdentity{
+		Provider: "oidc:" + doc.Issuer,
+		Subject:  subject,
+		Username: username,
+		Groups:   claimStrings(claims[setting.OIDCGroupsClaim]),
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("subject", subject).Msg("OIDC 用户映射失败")
+		fail(err.Error())
+		return
+	}
+
+	pair, err := createSession(c, user)
+	if err != nil {
+		fail("无法生成 Token")
+		return
+	}
+	log.Info().Str("用户", user.Username).Msg("OIDC 登录成功")
+	fragment := url.Values{}
+	fragment.Set("token", pair.AccessToken)
+	fragment.Set("refreshToken", pair.RefreshToken)
+	c.Redirect(http.StatusFound, "/login#"+fragment.Encode())
+}
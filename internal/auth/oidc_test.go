@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	code := m.Run()
+	// init() 会在工作目录下生成 JWT 密钥文件
+	os.RemoveAll(secretDirPath)
+	os.Exit(code)
+}
+
+// mockIssuer 本地模拟的 OIDC 认证服务器，校验 PKCE 并签发 RS256 id_token
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	codes     map[string]url.Values // 授权码 -> 授权请求参数
+	badNonce  bool
+	tokenErrs []string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "test-key",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// authorize 模拟用户在认证服务器完成登录，记录授权请求并返回授权码
+func (m *mockIssuer) authorize(t *testing.T, location string) (string, string) {
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, m.URL+"/authorize?") {
+		t.Fatalf("未重定向到授权端点: %s", location)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("授权请求缺少 PKCE 参数: %s", location)
+	}
+	if q.Get("response_type") != "code" || q.Get("client_id") != "cloudstream" || q.Get("nonce") == "" {
+		t.Fatalf("授权请求参数错误: %s", location)
+	}
+	code, _ := randomURLString(16)
+	m.mu.Lock()
+	m.codes[code] = q
+	m.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (m *mockIssuer) fail(w http.ResponseWriter, reason string) {
+	m.mu.Lock()
+	m.tokenErrs = append(m.tokenErrs, reason)
+	m.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": reason})
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if id, secret, ok := r.BasicAuth(); !ok || id != "cloudstream" || secret != "s3cret" {
+		m.fail(w, "client authentication failed")
+		return
+	}
+	m.mu.Lock()
+	auth, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	badNonce := m.badNonce
+	m.mu.Unlock()
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" {
+		m.fail(w, "unknown code")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.Get("code_challenge") {
+		m.fail(w, "code_verifier mismatch")
+		return
+	}
+
+	nonce := auth.Get("nonce")
+	if badNonce {
+		nonce = "forged"
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                m.URL,
+		"aud":                "cloudstream",
+		"sub":                "user-1",
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"preferred_username": "alice",
+		"groups":             []string{"media-admins"},
+	})
+	idToken.Header["kid"] = "test-key"
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		m.fail(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": signed})
+}
+
+func setupOIDC(t *testing.T) (*mockIssuer, *gin.Engine) {
+	if err := database.ConnectDatabase(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	issuer := newMockIssuer(t)
+	setting := database.GetSystemSetting()
+	setting.OIDCEnabled = true
+	setting.OIDCIssuer = issuer.URL
+	setting.OIDCClientID = "cloudstream"
+	setting.OIDCClientSecret = "s3cret"
+	setting.OIDCRedirectURL = "http://cloudstream.test/api/v1/oidc/callback"
+	setting.SSOAutoCreate = true
+	setting.SSOAdminGroups = "media-admins"
+	if err := database.DB.Save(&setting).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/oidc/login", OIDCLoginHandler)
+	r.GET("/oidc/callback", OIDCCallbackHandler)
+	return issuer, r
+}
+
+func get(r *gin.Engine, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// loginFragment 返回回调重定向到 /login# 之后的参数
+func loginFragment(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusFound || !strings.HasPrefix(location, "/login#") {
+		t.Fatalf("回调未重定向到登录页: %d %s", w.Code, location)
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(location, "/login#"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	issuer, r := setupOIDC(t)
+
+	w := get(r, "/oidc/login")
+	if w.Code != http.StatusFound {
+		t.Fatalf("登录入口返回 %d: %s", w.Code, w.Body.String())
+	}
+	code, state := issuer.authorize(t, w.Header().Get("Location"))
+
+	fragment := loginFragment(t, get(r, "/oidc/callback?code="+code+"&state="+url.QueryEscape(state)))
+	if fragment.Get("error") != "" {
+		t.Fatalf("登录失败: %s (认证服务器: %v)", fragment.Get("error"), issuer.tokenErrs)
+	}
+	if fragment.Get("token") == "" || fragment.Get("refreshToken") == "" {
+		t.Fatalf("回调未返回 Token: %v", fragment)
+	}
+
+	var user models.User
+	if err := database.DB.Where("username = ?", "alice").First(&user).Error; err != nil {
+		t.Fatalf("未自动创建本地用户: %v", err)
+	}
+	if user.Role != models.RoleAdmin {
+		t.Errorf("管理员组用户的角色为 %q", user.Role)
+	}
+	var link models.UserIdentity
+	if err := database.DB.Where("provider = ? AND subject = ?", "oidc:"+issuer.URL, "user-1").First(&link).Error; err != nil || link.UserID != user.ID {
+		t.Errorf("未记录外部身份映射: %v", err)
+	}
+
+	// state 只能使用一次
+	fragment = loginFragment(t, get(r, "/oidc/callback?code="+code+"&state="+url.QueryEscape(state)))
+	if fragment.Get("error") == "" {
+		t.Error("重复使用的 state 未被拒绝")
+	}
+}
+
+func TestOIDCRejectsMismatchedVerifier(t *testing.T) {
+	issuer, r := setupOIDC(t)
+
+	code, state := issuer.authorize(t, get(r, "/oidc/login").Header().Get("Location"))
+	// 篡改授权请求中的 code_challenge，模拟授权码被另一方截获后使用
+	issuer.mu.Lock()
+	issuer.codes[code].Set("code_challenge", "tampered")
+	issuer.mu.Unlock()
+
+	fragment := loginFragment(t, get(r, "/oidc/callback?code="+code+"&state="+url.QueryEscape(state)))
+	if !strings.Contains(fragment.Get("error"), "code_verifier mismatch") {
+		t.Fatalf("PKCE 校验失败时应拒绝登录，实际: %v", fragment)
+	}
+}
+
+func TestOIDCRejectsWrongNonce(t *testing.T) {
+	issuer, r := setupOIDC(t)
+	issuer.badNonce = true
+
+	code, state := issuer.authorize(t, get(r, "/oidc/login").Header().Get("Location"))
+	fragment := loginFragment(t, get(r, "/oidc/callback?code="+code+"&state="+url.QueryEscape(state)))
+	if !strings.Contains(fragment.Get("error"), "nonce") {
+		t.Fatalf("nonce 不匹配时应拒绝登录，实际: %v", fragment)
+	}
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	accessTokenTTL     = 15 * time.Minute // 过期后前端使用刷新令牌自动续期
+	refreshTokenTTL    = 30 * 24 * time.Hour
+	lastSeenResolution = time.Minute // 最近活跃时间的写库粒度，避免每个请求都写数据库
+)
+
+// TokenPair 登录成功后下发的凭证
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// describeDevice 从 User-Agent 中粗略识别浏览器与系统，用于会话列表展示
+func describeDevice(ua string) string {
+	lower := strings.ToLower(ua)
+	browser := "未知浏览器"
+	switch {
+	case strings.Contains(lower, "edg/"):
+		browser = "Edge"
+	case strings.Contains(lower, "chrome/"):
+		browser = "Chrome"
+	case strings.Contains(lower, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(lower, "safari/"):
+		browser = "Safari"
+	case strings.Contains(lower, "curl/"):
+		browser = "curl"
+	}
+	system := "未知系统"
+	switch {
+	case strings.Contains(lower, "android"):
+		system = "Android"
+	case strings.Contains(lower, "iphone"), strings.Contains(lower, "ipad"):
+		system = "iOS"
+	case strings.Contains(lower, "windows"):
+		system = "Windows"
+	case strings.Contains(lower, "mac os"):
+		system = "macOS"
+	case strings.Contains(lower, "linux"):
+		system = "Linux"
+	}
+	return browser + " / " + system
+}
+
+func generateAccessToken(user *models.User, sessionID uint) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": user.Username,
+		"version":  user.TokenVersion,
+		"sid":      sessionID,
+		"exp":      time.Now().Add(accessTokenTTL).Unix(),
+		"iat":      time.Now().Unix(),
+	})
+	return token.SignedString(jwtSecret)
+}
+
+// createSession 为用户创建新的登录会话并签发访问令牌与刷新令牌
+func createSession(c *gin.Context, user *models.User) (*TokenPair, error) {
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:           user.ID,
+		TokenVersion:     user.TokenVersion,
+		RefreshTokenHash: hashRefreshToken(refresh),
+		UserAgent:        c.Request.UserAgent(),
+		Device:           describeDevice(c.Request.UserAgent()),
+		IP:               ClientIP(c),
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(refreshTokenTTL),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, fmt.Errorf("保存会话失败: %w", err)
+	}
+
+	// 顺带清理该用户已过期或已吊销的旧会话
+	database.DB.Where("user_id = ? AND (expires_at < ? OR revoked_at IS NOT NULL)", user.ID, now).Delete(&models.Session{})
+
+	access, err := generateAccessToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int(accessTokenTTL.Seconds())}, nil
+}
+
+// validateSession 校验访问令牌对应的会话仍然有效，并按粒度刷新最近活跃信息
+func validateSession(c *gin.Context, sessionID uint, user *models.User) error {
+	var session models.Session
+	if err := database.DB.First(&session, sessionID).Error; err != nil {
+		return fmt.Errorf("会话不存在")
+	}
+	if session.UserID != user.ID || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return fmt.Errorf("会话已失效")
+	}
+	if time.Since(session.LastSeenAt) > lastSeenResolution {
+		database.DB.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": time.Now(),
+			"ip":           ClientIP(c),
+		})
+	}
+	return nil
+}
+
+// RevokeSession 吊销指定用户的某个会话
+func RevokeSession(userID, sessionID uint) error {
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("会话不存在或已失效")
+	}
+	return nil
+}
+
+// RevokeAllSessions 吊销用户的全部会话 (修改凭证、退出所有设备时使用)
+func RevokeAllSessions(userID uint) {
+	database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+}
+
+// ListActiveSessions 返回用户当前有效的会话
+func ListActiveSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// RefreshTokenHandler 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func RefreshTokenHandler(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少刷新令牌"})
+		return
+	}
+
+	var session models.Session
+	if err := database.DB.Where("refresh_token_hash = ?", hashRefreshToken(req.RefreshToken)).First(&session).Error; err != nil {
+		recordLoginFailure(c, "")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "刷新令牌无效"})
+		return
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新登录"})
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, session.UserID).Error; err != nil || user.TokenVersion != session.TokenVersion {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新登录"})
+		return
+	}
+
+	refresh, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法生成 Token"})
+		return
+	}
+	now := time.Now()
+	if err := database.DB.Model(&session).Updates(map[string]interface{}{
+		"refresh_token_hash": hashRefreshToken(refresh),
+		"last_seen_at":       now,
+		"ip":                 ClientIP(c),
+		"expires_at":         now.Add(refreshTokenTTL),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新会话失败"})
+		return
+	}
+
+	access, err := generateAccessToken(&user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法生成 Token"})
+		return
+	}
+	c.JSON(http.StatusOK, TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int(accessTokenTTL.Seconds())})
+}
+
+// respondWithToken 为已通过认证的用户创建会话并返回凭证
+func respondWithToken(c *gin.Context, user *models.User) {
+	pair, err := createSession(c, user)
+	if err != nil {
+		log.Error().Err(err).Str("用户", user.Username).Msg("创建登录会话失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法生成 Token"})
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
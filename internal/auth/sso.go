@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"cloudstream/internal/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ExternalIdentity 外部认证源提供的用户信息
+type ExternalIdentity struct {
+	Provider string
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// resolveExternalUser 将外部身份映射为本地用户：
+// 已绑定 -> 直接使用；允许同名绑定 -> 绑定同名用户；允许自动创建 -> 新建用户
+func resolveExternalUser(setting models.SystemSetting, ident ExternalIdentity) (*models.User, error) {
+	if ident.Subject == "" {
+		return nil, fmt.Errorf("外部身份缺少唯一标识")
+	}
+
+	role := mapExternalRole(setting, ident.Groups)
+
+	var link models.UserIdentity
+	if err := database.DB.Where("provider = ? AND subject = ?", ident.Provider, ident.Subject).First(&link).Error; err == nil {
+		var user models.User
+		if err := database.DB.First(&user, link.UserID).Error; err != nil {
+			return nil, fmt.Errorf("绑定的本地用户不存在")
+		}
+		// 配置了管理员组时，每次登录都按组同步角色
+		if setting.SSOAdminGroups != "" && role != user.Role {
+			user.Role = role
+			database.DB.Model(&user).Update("role", role)
+		}
+		return &user, nil
+	}
+
+	username := ident.Username
+	if username == "" {
+		username = ident.Subject
+	}
+
+	var user models.User
+	err := database.DB.Where("username = ?", username).First(&user).Error
+	switch {
+	case err == nil && setting.SSOMatchUsername:
+		// 绑定到同名本地用户
+	case err == nil:
+		return nil, fmt.Errorf("本地已存在同名用户 '%s'，但未允许按用户名绑定", username)
+	case setting.SSOAutoCreate:
+		randomPassword := make([]byte, 32)
+		if _, err := rand.Read(randomPassword); err != nil {
+			return nil, err
+		}
+		hash, err := utils.HashPassword(hex.EncodeToString(randomPassword))
+		if err != nil {
+			return nil, err
+		}
+		user = models.User{
+			Username:     username,
+			PasswordHash: hash,
+			TokenVersion: 1,
+			Role:         role,
+		}
+		if err := database.DB.Create(&user).Error; err != nil {
+			return nil, fmt.Errorf("创建本地用户失败: %w", err)
+		}
+		log.Info().Str("用户", username).Str("来源", ident.Provider).Str("角色", role).Msg("已为外部身份自动创建本地用户")
+	default:
+		return nil, fmt.Errorf("外部用户 '%s' 未绑定本地账户", username)
+	}
+
+	link = models.UserIdentity{Provider: ident.Provider, Subject: ident.Subject, UserID: user.ID}
+	if err := database.DB.Create(&link).Error; err != nil {
+		return nil, fmt.Errorf("保存身份绑定失败: %w", err)
+	}
+	return &user, nil
+}
+
+func mapExternalRole(setting models.SystemSetting, groups []string) string {
+	defaultRole := setting.SSODefaultRole
+	if defaultRole != models.RoleAdmin {
+		defaultRole = models.RoleViewer
+	}
+	if setting.SSOAdminGroups == "" {
+		return defaultRole
+	}
+	for _, admin := range strings.Split(setting.SSOAdminGroups, ",") {
+		admin = strings.TrimSpace(admin)
+		for _, g := range groups {
+			if admin != "" && strings.EqualFold(admin, strings.TrimSpace(g)) {
+				return models.RoleAdmin
+			}
+		}
+	}
+	return defaultRole
+}
+
+// ipAllowed 判断 ip 是否命中逗号分隔的 IP / CIDR 列表
+func ipAllowed(ipStr, allowList string) bool {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range strings.Split(allowList, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && cidr.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// userFromTrustedHeader 仅当请求直接来自白名单内的反向代理时，才信任其携带的用户头部
+func userFromTrustedHeader(c *gin.Context) (*models.User, bool) {
+	setting := database.GetSystemSetting()
+	if !setting.TrustedHeaderEnabled || setting.TrustedHeaderName == "" {
+		return nil, false
+	}
+	username := strings.TrimSpace(c.GetHeader(setting.TrustedHeaderName))
+	if username == "" {
+		return nil, false
+	}
+	if !ipAllowed(c.RemoteIP(), setting.TrustedProxyIPs) {
+		log.Warn().Str("ip", c.RemoteIP()).Msg("拒绝来自非可信代理的认证头部")
+		return nil, false
+	}
+
+	var groups []string
+	if setting.TrustedGroupsHeader != "" {
+		for _, g := range strings.Split(c.GetHeader(setting.TrustedGroupsHeader), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	user, err := resolveExternalUser(setting, ExternalIdentity{
+		Provider: models.IdentityProviderHeader,
+		Subject:  username,
+		Username: username,
+		Groups:   groups,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("用户", username).Msg("可信头部登录失败")
+		return nil, false
+	}
+	return user, true
+}
+
+// TrustedHeaderLoginHandler 通过可信反代头部换取 Token，供前端在 SSO 环境下免密登录
+func TrustedHeaderLoginHandler(c *gin.Context) {
+	user, ok := userFromTrustedHeader(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未通过可信代理认证"})
+		return
+	}
+	respondWithToken(c, user)
+}
+
+// SSOConfigHandler 返回登录页需要的 SSO 开关信息 (公开接口)
+func SSOConfigHandler(c *gin.Context) {
+	setting := database.GetSystemSetting()
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"oidcEnabled":          setting.OIDCEnabled && setting.OIDCIssuer != "",
+		"trustedHeaderEnabled": setting.TrustedHeaderEnabled,
+	}})
+}
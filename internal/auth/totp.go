@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"cloudstream/internal/utils"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer        = "CloudStream"
+	totpDigits        = 6
+	totpPeriod        = 30
+	totpSkew          = 1 // 允许前后各 1 个周期的时间偏差
+	recoveryCodeCount = 10
+	challengeTTL      = 5 * time.Minute
+	challengePurpose  = "2fa"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret 生成 160 位随机密钥 (Base32 编码)
+func NewTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPProvisioningURI 生成供验证器 App 扫码的 otpauth:// 地址
+func TOTPProvisioningURI(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprintf("%d", totpDigits))
+	q.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, q.Encode())
+}
+
+func totpCode(secret []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// ValidateTOTP 校验 6 位动态码 (RFC 6238)
+func ValidateTOTP(secret, code string, now time.Time) bool {
+	_, ok := matchTOTP(secret, code, now)
+	return ok
+}
+
+// matchTOTP 校验动态码，成功时返回其对应的时间步
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+	counter := now.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := counter + int64(i)
+		expected := totpCode(key, uint64(step))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// SealTOTPSecret 加密 TOTP 密钥后再写入数据库
+func SealTOTPSecret(secret string) (string, error) {
+	return utils.EncryptClientSecret(secret, jwtSecret)
+}
+
+// OpenTOTPSecret 解密数据库中的 TOTP 密钥
+func OpenTOTPSecret(sealed string) (string, error) {
+	return utils.DecryptClientSecret(sealed, jwtSecret)
+}
+
+// VerifyUserTOTP 使用用户已保存的密钥校验动态码；已使用过的时间步 (及更早的) 不再接受，防止重放
+func VerifyUserTOTP(user *models.User, code string) bool {
+	if user.TOTPSecret == "" {
+		return false
+	}
+	secret, err := OpenTOTPSecret(user.TOTPSecret)
+	if err != nil {
+		return false
+	}
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return false
+	}
+	// 条件更新保证并发提交同一个码时只有一次成功
+	result := database.DB.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	user.TOTPLastStep = step
+	return true
+}
+
+// CheckTOTPLocked 两步验证管理接口校验动态码前检查用户名是否被锁定，已锁定时写入响应并返回 true
+func CheckTOTPLocked(c *gin.Context, username string) bool {
+	return checkUserLocked(c, username)
+}
+
+// RecordTOTPFailure 两步验证管理接口中动态码或恢复码错误时，与登录共用失败计数和锁定
+func RecordTOTPFailure(c *gin.Context, username string) {
+	recordLoginFailure(c, username)
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRecoveryCodes 生成一组一次性恢复码，返回明文及用于存储的摘要 JSON
+func GenerateRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, "", err
+		}
+		raw := hex.EncodeToString(buf)
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	data, _ := json.Marshal(hashes)
+	return codes, string(data), nil
+}
+
+// ConsumeRecoveryCode 校验并作废一个恢复码，作废结果写入数据库后才返回 true，并更新 user.TOTPRecoveryCodes
+func ConsumeRecoveryCode(user *models.User, code string) bool {
+	var hashes []string
+	if err := json.Unmarshal([]byte(user.TOTPRecoveryCodes), &hashes); err != nil {
+		return false
+	}
+	target := hashRecoveryCode(code)
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(target)) == 1 {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			data, _ := json.Marshal(hashes)
+			// 条件更新保证并发提交同一个恢复码时只有一次成功；写入失败时恢复码不算已使用
+			result := database.DB.Model(&models.User{}).
+				Where("id = ? AND totp_recovery_codes = ?", user.ID, user.TOTPRecoveryCodes).
+				Update("totp_recovery_codes", string(data))
+			if result.Error != nil || result.RowsAffected == 0 {
+				return false
+			}
+			user.TOTPRecoveryCodes = string(data)
+			return true
+		}
+	}
+	return false
+}
+
+// RemainingRecoveryCodes 返回剩余可用的恢复码数量
+func RemainingRecoveryCodes(user *models.User) int {
+	var hashes []string
+	if err := json.Unmarshal([]byte(user.TOTPRecoveryCodes), &hashes); err != nil {
+		return 0
+	}
+	return len(hashes)
+}
+
+// generateChallengeToken 生成仅用于两步验证第二步的短期凭证
+func generateChallengeToken(username string, tokenVersion int) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": username,
+		"version":  tokenVersion,
+		"purpose":  challengePurpose,
+		"exp":      time.Now().Add(challengeTTL).Unix(),
+		"iat":      time.Now().Unix(),
+	})
+	return token.SignedString(jwtSecret)
+}
+
+func parseChallengeToken(tokenString string) (string, int, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("非预期的签名方法: %v", token.Header["alg"])
+		}
+		return jwtSecret, nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", 0, fmt.Errorf("凭证无效")
+	}
+	if purpose, _ := claims["purpose"].(string); purpose != challengePurpose {
+		return "", 0, fmt.Errorf("凭证用途不匹配")
+	}
+	username, _ := claims["username"].(string)
+	version, _ := claims["version"].(float64)
+	return username, int(version), nil
+}
+
+type TOTPLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// LoginTOTPHandler 两步登录的第二步：提交动态码或恢复码换取正式 Token
+func LoginTOTPHandler(c *gin.Context) {
+	var req TOTPLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码不能为空"})
+		return
+	}
+	username, version, err := parseChallengeToken(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录会话已过期，请重新登录"})
+		return
+	}
+	if checkUserLocked(c, username) {
+		return
+	}
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil || user.TokenVersion != version || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录会话已失效，请重新登录"})
+		return
+	}
+
+	if req.Code != "" {
+		if !VerifyUserTOTP(&user, req.Code) {
+			recordLoginFailure(c, user.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "动态验证码错误"})
+			return
+		}
+	} else {
+		if !ConsumeRecoveryCode(&user, req.RecoveryCode) {
+			recordLoginFailure(c, user.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "恢复码无效"})
+			return
+		}
+	}
+
+	recordLoginSuccess(c, user.Username)
+	respondWithToken(c, &user)
+}
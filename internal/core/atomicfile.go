@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// tempSuffix 原子写入使用的临时文件后缀；进程中断后残留的临时文件在下次写入同一文件时被覆盖
+const tempSuffix = ".cloudstream-tmp"
+
+// tempFileSet 记录一次扫描创建后未能删除的临时文件，扫描结束时只清理这些文件，不触碰目录下的其他文件
+type tempFileSet struct {
+	sync.Mutex
+	paths map[string]struct{}
+}
+
+func (s *tempFileSet) add(path string) {
+	s.Lock()
+	if s.paths == nil {
+		s.paths = make(map[string]struct{})
+	}
+	s.paths[path] = struct{}{}
+	s.Unlock()
+}
+
+func (s *tempFileSet) remove(path string) {
+	s.Lock()
+	delete(s.paths, path)
+	s.Unlock()
+}
+
+// cleanup 删除仍然残留的临时文件，返回删除的数量
+func (s *tempFileSet) cleanup() int {
+	s.Lock()
+	defer s.Unlock()
+	removed := 0
+	for path := range s.paths {
+		if err := os.Remove(path); err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			continue
+		}
+		delete(s.paths, path)
+	}
+	return removed
+}
+
+// writeFileAtomic 将 r 的内容写入 path：先写到同目录下的临时文件，size > 0 时校验写入的字节数，
+// 成功后重命名为目标文件；任何一步失败都会删除临时文件，目标路径不会留下不完整的文件。
+// 临时文件在写入期间登记到 temps，删除失败时保留登记，由扫描结束时统一清理
+func writeFileAtomic(path string, r io.Reader, size int64, temps *tempFileSet) error {
+	tmpPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+tempSuffix)
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	temps.add(tmpPath)
+	n, err := io.Copy(f, r)
+	if err == nil && size > 0 && n != size {
+		err = fmt.Errorf("文件大小不一致: 预期 %d 字节，实际 %d 字节", size, n)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		if removeErr := os.Remove(tmpPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			return err
+		}
+	}
+	temps.remove(tmpPath)
+	return err
+}
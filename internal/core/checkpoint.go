@@ -0,0 +1,189 @@
+package core
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"encoding/json"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkpointMaxAge 超过该时长的断点不再用于续跑，避免跳过早已变化的目录
+const checkpointMaxAge = 24 * time.Hour
+
+// checkpointSaveInterval 扫描过程中保存断点的间隔
+const checkpointSaveInterval = 10 * time.Second
+
+// dirNode 扫描中的目录，自身列表、所有文件和子目录都处理完毕后视为完成
+type dirNode struct {
+	relPath string // 相对任务源目录的云盘路径
+	parent  *dirNode
+	pending atomic.Int32
+	failed  atomic.Bool // 自身或某个子目录扫描失败
+}
+
+func newDirNode(relPath string, parent *dirNode) *dirNode {
+	n := &dirNode{relPath: relPath, parent: parent}
+	n.pending.Store(1)
+	return n
+}
+
+// done 完成一项待处理工作；全部完成后记录到断点并通知上级目录
+func (n *dirNode) done(cp *scanCheckpoint) {
+	if n.pending.Add(-1) != 0 {
+		return
+	}
+	if n.failed.Load() {
+		if n.parent != nil {
+			n.parent.failed.Store(true)
+		}
+	} else {
+		cp.complete(n.relPath)
+	}
+	if n.parent != nil {
+		n.parent.done(cp)
+	}
+}
+
+// scanCheckpoint 一次扫描的断点：已完整扫描的目录在中断或部分失败后再次执行时直接跳过
+type scanCheckpoint struct {
+	sync.Mutex
+	taskID    uint
+	subPath   string
+	resumed   map[string]struct{} // 上次运行已完成、本次跳过的目录
+	completed map[string]struct{} // 本次运行完成的目录 (含跳过的)
+	skipped   []string            // 跳过目录对应的本地路径，不参与同步删除
+}
+
+// loadCheckpoint 读取任务在该扫描范围的断点；已过期的断点会被丢弃，其他范围的断点不受影响
+func loadCheckpoint(taskID uint, subPath string) *scanCheckpoint {
+	cp := &scanCheckpoint{
+		taskID:    taskID,
+		subPath:   subPath,
+		resumed:   make(map[string]struct{}),
+		completed: make(map[string]struct{}),
+	}
+	var saved models.TaskCheckpoint
+	if err := database.DB.Where("task_id = ? AND sub_path = ?", taskID, subPath).First(&saved).Error; err != nil {
+		return cp
+	}
+	if time.Since(saved.UpdatedAt) > checkpointMaxAge {
+		cp.clear()
+		return cp
+	}
+	var dirs []string
+	json.Unmarshal([]byte(saved.CompletedDirs), &dirs)
+	for _, d := range dirs {
+		cp.resumed[d] = struct{}{}
+	}
+	return cp
+}
+
+// isResumed 目录是否在上次运行中已完整扫描
+func (cp *scanCheckpoint) isResumed(relPath string) bool {
+	_, ok := cp.resumed[relPath]
+	return ok
+}
+
+// skip 记录跳过的目录，它的本地文件在本次运行中视为仍然有效
+func (cp *scanCheckpoint) skip(localPath string) {
+	cp.Lock()
+	cp.skipped = append(cp.skipped, localPath)
+	cp.Unlock()
+}
+
+func (cp *scanCheckpoint) skippedPaths() []string {
+	cp.Lock()
+	defer cp.Unlock()
+	return append([]string(nil), cp.skipped...)
+}
+
+func (cp *scanCheckpoint) complete(relPath string) {
+	cp.Lock()
+	cp.completed[relPath] = struct{}{}
+	cp.Unlock()
+}
+
+// completedDirs 返回已完成的最上层目录 (祖先目录已完成时省略其子目录)
+func (cp *scanCheckpoint) completedDirs() []string {
+	cp.Lock()
+	defer cp.Unlock()
+	var dirs []string
+	for d := range cp.completed {
+		if d == "" || !cp.ancestorCompleted(d) {
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+func (cp *scanCheckpoint) ancestorCompleted(p string) bool {
+	for p != "" {
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			p = p[:i]
+		} else {
+			p = ""
+		}
+		if _, ok := cp.completed[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// save 持久化断点；调用前需先写入已处理文件的记录，保证跳过的目录在数据库中有完整记录
+func (cp *scanCheckpoint) save(failed []string) {
+	completed, _ := json.Marshal(cp.completedDirs())
+	if failed == nil {
+		failed = []string{}
+	}
+	failedJSON, _ := json.Marshal(failed)
+	saved := models.TaskCheckpoint{TaskID: cp.taskID, SubPath: cp.subPath}
+	database.DB.Where("task_id = ? AND sub_path = ?", cp.taskID, cp.subPath).FirstOrInit(&saved)
+	saved.CompletedDirs = string(completed)
+	saved.FailedDirs = string(failedJSON)
+	if err := database.DB.Save(&saved).Error; err != nil {
+		log.Error().Err(err).Uint("taskID", cp.taskID).Msg("保存扫描断点失败")
+	}
+}
+
+// clear 删除本次扫描范围的断点
+func (cp *scanCheckpoint) clear() {
+	database.DB.Where("task_id = ? AND sub_path = ?", cp.taskID, cp.subPath).Delete(&models.TaskCheckpoint{})
+}
+
+// ClearCheckpoint 删除任务所有范围的断点，下次执行将完整扫描
+func ClearCheckpoint(taskID uint) {
+	database.DB.Where("task_id = ?", taskID).Delete(&models.TaskCheckpoint{})
+}
+
+// CheckpointInfo 断点详情
+type CheckpointInfo struct {
+	SubPath       string    `json:"subPath"`
+	CompletedDirs []string  `json:"completedDirs"`
+	FailedDirs    []string  `json:"failedDirs"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	Expired       bool      `json:"expired"`
+}
+
+// GetCheckpoints 读取任务各扫描范围的断点，完整扫描的断点 (SubPath 为空) 排在最前
+func GetCheckpoints(taskID uint) []CheckpointInfo {
+	var saved []models.TaskCheckpoint
+	database.DB.Where("task_id = ?", taskID).Order("sub_path").Find(&saved)
+	infos := make([]CheckpointInfo, len(saved))
+	for i, s := range saved {
+		infos[i] = CheckpointInfo{
+			SubPath:   s.SubPath,
+			UpdatedAt: s.UpdatedAt,
+			Expired:   time.Since(s.UpdatedAt) > checkpointMaxAge,
+		}
+		json.Unmarshal([]byte(s.CompletedDirs), &infos[i].CompletedDirs)
+		json.Unmarshal([]byte(s.FailedDirs), &infos[i].FailedDirs)
+	}
+	return infos
+}
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"strings"
+)
+
+// 任务运行结果，决定是否触发下游任务
+const (
+	RunOutcomeSuccess = "success"
+	RunOutcomeFailure = "failure"
+	RunOutcomeStopped = "stopped" // 手动停止或任务被修改，不触发下游任务
+)
+
+// conditionMatches 上游运行结果是否满足依赖条件
+func conditionMatches(condition, outcome string) bool {
+	switch condition {
+	case models.DependencyAlways:
+		return outcome == RunOutcomeSuccess || outcome == RunOutcomeFailure
+	case models.DependencyOnFailure:
+		return outcome == RunOutcomeFailure
+	default:
+		return outcome == RunOutcomeSuccess
+	}
+}
+
+// ValidateDependency 校验新的依赖关系：条件合法、上游任务存在且不会形成循环依赖
+func ValidateDependency(taskID, dependsOnID uint, condition string) error {
+	switch condition {
+	case models.DependencyOnSuccess, models.DependencyOnFailure, models.DependencyAlways:
+	default:
+		return fmt.Errorf("不支持的触发条件: %s", condition)
+	}
+	if taskID == dependsOnID {
+		return fmt.Errorf("任务不能依赖自身")
+	}
+	var upstream models.Task
+	if err := database.DB.First(&upstream, dependsOnID).Error; err != nil {
+		return fmt.Errorf("找不到上游任务")
+	}
+
+	var deps []models.TaskDependency
+	if err := database.DB.Find(&deps).Error; err != nil {
+		return err
+	}
+	// 新增 dependsOnID → taskID 后，若从 taskID 沿下游方向能到达 dependsOnID 则形成环
+	downstream := make(map[uint][]uint)
+	for _, d := range deps {
+		downstream[d.DependsOnID] = append(downstream[d.DependsOnID], d.TaskID)
+	}
+	prev := map[uint]uint{taskID: 0}
+	queue := []uint{taskID}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == dependsOnID {
+			return fmt.Errorf("会形成循环依赖: %s", describeCycle(prev, taskID, dependsOnID))
+		}
+		for _, next := range downstream[current] {
+			if _, seen := prev[next]; !seen {
+				prev[next] = current
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// describeCycle 将检测到的环路转换为任务名称链，便于提示
+func describeCycle(prev map[uint]uint, from, to uint) string {
+	ids := []uint{to}
+	for id := to; id != from; {
+		id = prev[id]
+		ids = append(ids, id)
+	}
+	names := make([]string, 0, len(ids)+1)
+	for i := len(ids) - 1; i >= 0; i-- {
+		names = append(names, taskName(ids[i]))
+	}
+	names = append(names, taskName(from))
+	return strings.Join(names, " → ")
+}
+
+func taskName(id uint) string {
+	var task models.Task
+	if err := database.DB.Select("name").First(&task, id).Error; err != nil {
+		return fmt.Sprintf("#%d", id)
+	}
+	return task.Name
+}
+
+// DeleteTaskDependencies 删除与任务相关的所有依赖 (作为上游或下游)
+func DeleteTaskDependencies(taskID uint) {
+	database.DB.Where("task_id = ? OR depends_on_id = ?", taskID, taskID).Delete(&models.TaskDependency{})
+}
+
+// triggerDependents 上游任务结束后，将满足条件的下游任务加入执行队列
+func triggerDependents(task models.Task, outcome string) {
+	if outcome == RunOutcomeStopped {
+		return
+	}
+	var deps []models.TaskDependency
+	if err := database.DB.Where("depends_on_id = ?", task.ID).Find(&deps).Error; err != nil {
+		log.Error().Err(err).Str("任务", task.Name).Msg("读取下游任务失败")
+		return
+	}
+	for _, dep := range deps {
+		if !conditionMatches(dep.Condition, outcome) {
+			continue
+		}
+		var next models.Task
+		if err := database.DB.First(&next, dep.TaskID).Error; err != nil || !next.Enabled {
+			continue
+		}
+		if EnqueueTask(next, nil, RunSourceChain) {
+			log.Info().Str("上游任务", task.Name).Str("任务", next.Name).Str("条件", dep.Condition).Msg("触发下游任务")
+		} else {
+			log.Warn().Str("上游任务", task.Name).Str("任务", next.Name).Msg("下游任务已在运行或排队，跳过此次触发")
+		}
+	}
+}
+
+// PipelineNode 流水线中的任务，Level 为距起点任务的最长层级
+type PipelineNode struct {
+	TaskID        uint   `json:"taskId"`
+	TaskName      string `json:"taskName"`
+	Enabled       bool   `json:"enabled"`
+	LastRunStatus string `json:"lastRunStatus"`
+	IsRunning     bool   `json:"isRunning"`
+	IsQueued      bool   `json:"isQueued"`
+	Level         int    `json:"level"`
+}
+
+// PipelineEdge 依赖关系，From 为上游任务
+type PipelineEdge struct {
+	ID        uint   `json:"id"`
+	From      uint   `json:"from"`
+	To        uint   `json:"to"`
+	Condition string `json:"condition"`
+}
+
+// Pipeline 由依赖关系连接起来的一组任务，节点按执行顺序排列
+type Pipeline struct {
+	Nodes []PipelineNode `json:"nodes"`
+	Edges []PipelineEdge `json:"edges"`
+}
+
+// BuildPipelines 按依赖关系将任务分组为流水线；没有任何依赖的任务不出现在结果中
+func BuildPipelines() ([]Pipeline, error) {
+	var deps []models.TaskDependency
+	if err := database.DB.Order("id").Find(&deps).Error; err != nil {
+		return nil, err
+	}
+	var tasks []models.Task
+	if err := database.DB.Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+
+	// 并查集划分连通分量
+	parent := make(map[uint]uint)
+	var find func(uint) uint
+	find = func(x uint) uint {
+		if parent[x] != x {
+			parent[x] = find(parent[x])
+		}
+		return parent[x]
+	}
+	for _, d := range deps {
+		for _, id := range []uint{d.TaskID, d.DependsOnID} {
+			if _, ok := parent[id]; !ok {
+				parent[id] = id
+			}
+		}
+		parent[find(d.TaskID)] = find(d.DependsOnID)
+	}
+
+	groups := make(map[uint]*Pipeline)
+	var roots []uint
+	for _, d := range deps {
+		root := find(d.TaskID)
+		p, ok := groups[root]
+		if !ok {
+			p = &Pipeline{}
+			groups[root] = p
+			roots = append(roots, root)
+		}
+		p.Edges = append(p.Edges, PipelineEdge{ID: d.ID, From: d.DependsOnID, To: d.TaskID, Condition: d.Condition})
+	}
+
+	pipelines := make([]Pipeline, 0, len(roots))
+	for _, root := range roots {
+		p := groups[root]
+		p.Nodes = orderPipelineNodes(p.Edges, byID)
+		pipelines = append(pipelines, *p)
+	}
+	return pipelines, nil
+}
+
+// orderPipelineNodes 拓扑排序，同一层级按任务 ID 排列
+func orderPipelineNodes(edges []PipelineEdge, byID map[uint]models.Task) []PipelineNode {
+	indegree := make(map[uint]int)
+	next := make(map[uint][]uint)
+	for _, e := range edges {
+		if _, ok := indegree[e.From]; !ok {
+			indegree[e.From] = 0
+		}
+		indegree[e.To]++
+		next[e.From] = append(next[e.From], e.To)
+	}
+	level := make(map[uint]int)
+	var ready []uint
+	for id, n := range indegree {
+		if n == 0 {
+			ready = append(ready, id)
+		}
+	}
+	var order []uint
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return ready[i] < ready[j] })
+		current := ready[0]
+		ready = ready[1:]
+		order = append(order, current)
+		for _, to := range next[current] {
+			if level[current]+1 > level[to] {
+				level[to] = level[current] + 1
+			}
+			if indegree[to]--; indegree[to] == 0 {
+				ready = append(ready, to)
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return level[order[i]] < level[order[j]] })
+
+	nodes := make([]PipelineNode, 0, len(order))
+	for _, id := range order {
+		t := byID[id]
+		nodes = append(nodes, PipelineNode{
+			TaskID:        id,
+			TaskName:      t.Name,
+			Enabled:       t.Enabled,
+			LastRunStatus: t.LastRunStatus,
+			IsRunning:     IsTaskRunning(id),
+			IsQueued:      IsTaskQueued(id),
+			Level:         level[id],
+		})
+	}
+	return nodes
+}
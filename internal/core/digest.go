@@ -0,0 +1,148 @@
+package core
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"cloudstream/internal/notify"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 汇总模式
+const (
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+)
+
+// queueDigest 将事件暂存，等待汇总发送；只保存纯文本标题，发送时再按渠道格式渲染
+func queueDigest(channel models.NotificationChannel, data notify.EventData) {
+	title, _, err := RenderEvent(data, notify.FormatPlain)
+	if err != nil {
+		title, _, _ = notify.Render(notify.DefaultTemplates[data.Event], notify.FormatPlain, data)
+	}
+	item := models.NotificationDigestItem{CreatedAt: data.OccurredAt, ChannelID: channel.ID, Event: data.Event, Title: title}
+	if err := database.DB.Create(&item).Error; err != nil {
+		log.Error().Err(err).Str("渠道", channel.Name).Msg("保存汇总事件失败")
+	}
+}
+
+// ParseDigestTime 解析 daily 模式的发送时间 (HH:MM)
+func ParseDigestTime(value string) (int, int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, 0, fmt.Errorf("汇总发送时间格式应为 HH:MM")
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// digestDue 返回渠道当前周期的起点，以及是否到了发送时间
+func digestDue(channel models.NotificationChannel, now time.Time) (time.Time, bool) {
+	var boundary time.Time
+	switch channel.DigestMode {
+	case DigestHourly:
+		boundary = now.Truncate(time.Hour)
+	case DigestDaily:
+		hour, minute, err := ParseDigestTime(channel.DigestTime)
+		if err != nil {
+			hour, minute = 9, 0
+		}
+		boundary = time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		if boundary.After(now) {
+			boundary = boundary.AddDate(0, 0, -1)
+		}
+	default:
+		return time.Time{}, false
+	}
+	return boundary, channel.LastDigestAt == nil || channel.LastDigestAt.Before(boundary)
+}
+
+// flushDigests 检查所有汇总模式的渠道，到期且有暂存事件时合并发送
+func flushDigests(now time.Time) {
+	var channels []models.NotificationChannel
+	if err := database.DB.Where("digest_mode <> ''").Find(&channels).Error; err != nil {
+		log.Error().Err(err).Msg("加载汇总渠道失败")
+		return
+	}
+	for _, channel := range channels {
+		boundary, due := digestDue(channel, now)
+		if !due {
+			continue
+		}
+		var items []models.NotificationDigestItem
+		database.DB.Where("channel_id = ? AND created_at < ?", channel.ID, boundary).Order("id asc").Find(&items)
+		if len(items) > 0 && channel.Enabled {
+			data := buildDigest(items, channel.LastDigestAt, boundary)
+			format := ChannelFormat(channel)
+			title, body, err := RenderEvent(data, format)
+			if err != nil {
+				log.Error().Err(err).Str("渠道", channel.Name).Msg("渲染汇总通知失败，改用默认模板")
+				title, body, _ = notify.Render(notify.DefaultTemplates[notify.EventDigest], format, data)
+			}
+			// 写入发件箱失败时保留暂存事件和周期起点，下次检查时重试
+			if err := enqueueDelivery(channel, notify.Message{Event: notify.EventDigest, Title: title, Body: body, Format: format, Data: &data}); err != nil {
+				continue
+			}
+			ids := make([]uint, len(items))
+			for i, item := range items {
+				ids[i] = item.ID
+			}
+			database.DB.Delete(&models.NotificationDigestItem{}, ids)
+		}
+		// 汇总写入发件箱后才推进周期起点，统计周期需使用更新前的 LastDigestAt
+		database.DB.Model(&channel).Update("last_digest_at", boundary)
+	}
+}
+
+func buildDigest(items []models.NotificationDigestItem, since *time.Time, until time.Time) notify.EventData {
+	counts := make(map[string]int)
+	entries := make([]notify.DigestEntry, len(items))
+	for i, item := range items {
+		counts[item.Event]++
+		entries[i] = notify.DigestEntry{Time: item.CreatedAt, Event: item.Event, Title: item.Title}
+	}
+	from := items[0].CreatedAt
+	if since != nil {
+		from = *since
+	}
+
+	events := make([]string, 0, len(counts))
+	for e := range counts {
+		events = append(events, e)
+	}
+	sort.Strings(events)
+	parts := make([]string, len(events))
+	for i, e := range events {
+		parts[i] = fmt.Sprintf("%s %d 条", e, counts[e])
+	}
+
+	return notify.EventData{
+		Event:      notify.EventDigest,
+		OccurredAt: until,
+		StartedAt:  from,
+		FinishedAt: until,
+		Message: fmt.Sprintf("统计周期: %s 至 %s\n%s", from.Format("2006-01-02 15:04"), until.Format("2006-01-02 15:04"),
+			strings.Join(parts, "，")),
+		Entries: entries,
+	}
+}
+
+// StartDigestWorker 每分钟检查一次汇总渠道
+func StartDigestWorker() {
+	workerWG.Add(1)
+	go func() {
+		defer workerWG.Done()
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				flushDigests(now)
+			case <-workerStop:
+				return
+			}
+		}
+	}()
+}
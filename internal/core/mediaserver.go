@@ -0,0 +1,96 @@
+package core
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/mediaserver"
+	"cloudstream/internal/models"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"path/filepath"
+	"sort"
+)
+
+// NewMediaServer 由数据库配置创建媒体服务器客户端
+func NewMediaServer(server models.MediaServer) (mediaserver.Server, error) {
+	return mediaserver.New(server.Type, mediaserver.Config{URL: server.URL, APIKey: server.APIKey})
+}
+
+// ValidateTaskPathMapping 按目录刷新时，任务的本地路径必须被媒体服务器的路径映射覆盖
+func ValidateTaskPathMapping(task models.Task, server models.MediaServer) error {
+	mappings, err := mediaserver.ParsePathMappings(server.PathMappings)
+	if err != nil {
+		return err
+	}
+	if task.RefreshMode != models.RefreshModePath {
+		return nil
+	}
+	if _, ok := mediaserver.TranslatePath(mappings, task.LocalPath); !ok {
+		return fmt.Errorf("任务 %s 的本地路径 %s 不在媒体服务器 %s 的路径映射范围内", task.Name, task.LocalPath, server.Name)
+	}
+	return nil
+}
+
+// changedDirs 返回有文件新增或删除的目录 (去重并排序)
+func changedDirs(fileLists ...[]string) []string {
+	seen := make(map[string]struct{})
+	for _, files := range fileLists {
+		for _, f := range files {
+			seen[filepath.Dir(f)] = struct{}{}
+		}
+	}
+	dirs := make([]string, 0, len(seen))
+	for d := range seen {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// refreshMediaLibrary 按任务的刷新方式通知媒体服务器，dirs 为本次有变化的本地目录
+func refreshMediaLibrary(task models.Task, dirs []string) error {
+	if task.RefreshMode == "" || task.MediaServerID == 0 {
+		return nil
+	}
+	if len(dirs) == 0 {
+		log.Info().Str("任务", task.Name).Msg("本次扫描没有文件变化，跳过媒体库刷新")
+		return nil
+	}
+
+	var server models.MediaServer
+	if err := database.DB.First(&server, task.MediaServerID).Error; err != nil {
+		return fmt.Errorf("媒体服务器不存在")
+	}
+	if !server.Enabled {
+		return nil
+	}
+	client, err := NewMediaServer(server)
+	if err != nil {
+		return err
+	}
+
+	if task.RefreshMode == models.RefreshModePath {
+		mappings, err := mediaserver.ParsePathMappings(server.PathMappings)
+		if err != nil {
+			return err
+		}
+		remote := make([]string, 0, len(dirs))
+		for _, dir := range dirs {
+			translated, ok := mediaserver.TranslatePath(mappings, dir)
+			if !ok {
+				return fmt.Errorf("目录 %s 没有匹配的路径映射", dir)
+			}
+			remote = append(remote, translated)
+		}
+		log.Debug().Strs("本地目录", dirs).Strs("媒体服务器目录", remote).Msg("路径映射转换")
+		if err := client.RefreshPaths(remote); err != nil {
+			return fmt.Errorf("刷新 %s 指定目录失败: %w", server.Name, err)
+		}
+		log.Info().Str("任务", task.Name).Str("媒体服务器", server.Name).Strs("目录", remote).Msg("已通知媒体服务器刷新变化的目录")
+		return nil
+	}
+	if err := client.RefreshLibrary(); err != nil {
+		return fmt.Errorf("刷新 %s 媒体库失败: %w", server.Name, err)
+	}
+	log.Info().Str("任务", task.Name).Str("媒体服务器", server.Name).Msg("已通知媒体服务器刷新媒体库")
+	return nil
+}
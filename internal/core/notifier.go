@@ -1,99 +1,169 @@
 package core
 
 import (
-	"bytes"
 	"cloudstream/internal/database"
 	"cloudstream/internal/models"
-	"encoding/json"
-	"fmt"
+	"cloudstream/internal/notify"
 	"github.com/rs/zerolog/log"
 	"io"
-	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-// 发送通知 (生产环境)
-func SendNotification(title, content string) {
-	var user models.User
-	if err := database.DB.First(&user).Error; err != nil {
+// channelSubscribes 判断渠道是否订阅了该事件 (Events 为空表示订阅全部)
+func channelSubscribes(channel models.NotificationChannel, event string) bool {
+	if strings.TrimSpace(channel.Events) == "" || event == notify.EventTest {
+		return true
+	}
+	for _, e := range strings.Split(channel.Events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// channelMatchesTask 判断渠道的任务过滤条件；与任务无关的事件 (如登录告警) 不受过滤影响
+func channelMatchesTask(channel models.NotificationChannel, taskID uint) bool {
+	if taskID == 0 || strings.TrimSpace(channel.TaskIDs) == "" {
+		return true
+	}
+	for _, id := range strings.Split(channel.TaskIDs, ",") {
+		if strings.TrimSpace(id) == strconv.FormatUint(uint64(taskID), 10) {
+			return true
+		}
+	}
+	return false
+}
+
+// SendEvent 将事件按各渠道的消息格式渲染后同步写入发件箱，由投递协程负责发送与重试；
+// 返回时事件已持久化，进程随后退出或崩溃也不会丢失
+func SendEvent(data notify.EventData) {
+	if data.OccurredAt.IsZero() {
+		data.OccurredAt = time.Now()
+	}
+	var channels []models.NotificationChannel
+	if err := database.DB.Where("enabled = ?", true).Find(&channels).Error; err != nil {
+		log.Error().Err(err).Msg("加载通知渠道失败")
 		return
 	}
 
-	if user.NotifyType == models.NotifyTypeTelegram {
-		if user.TelegramToken != "" && user.TelegramChatID != "" {
-			go pushToTelegram(user.TelegramToken, user.TelegramChatID, fmt.Sprintf("*%s*\n%s", title, content))
+	rendered := make(map[string]notify.Message)
+	for _, channel := range channels {
+		if !channelSubscribes(channel, data.Event) || !channelMatchesTask(channel, data.TaskID) {
+			continue
 		}
-	} else {
-		// 默认 Webhook
-		if user.WebhookURL != "" {
-			go pushToWebhook(user.WebhookURL, title, content)
+		if channel.DigestMode != "" {
+			queueDigest(channel, data)
+			continue
 		}
+		format := ChannelFormat(channel)
+		msg, ok := rendered[format]
+		if !ok {
+			title, body, err := RenderEvent(data, format)
+			if err != nil {
+				log.Error().Err(err).Str("事件", data.Event).Str("格式", format).Msg("渲染通知模板失败，改用默认模板")
+				title, body, _ = notify.Render(notify.DefaultTemplates[data.Event], format, data)
+			}
+			msg = notify.Message{Event: data.Event, Title: title, Body: body, Format: format, Data: &data}
+			rendered[format] = msg
+		}
+		enqueueDelivery(channel, msg)
 	}
 }
 
-// 发送测试通知
-func SendTestNotification(req map[string]string) error {
-	nType := req["type"]
-	if nType == models.NotifyTypeTelegram {
-		token := req["token"]
-		chatID := req["chatId"]
-		if token == "" || chatID == "" {
-			return fmt.Errorf("Telegram Token 和 ChatID 不能为空")
-		}
-		return pushToTelegram(token, chatID, "*CloudStream 测试*\n通知服务配置成功！")
-	} else {
-		url := req["url"]
-		if url == "" {
-			return fmt.Errorf("Webhook URL 不能为空")
+// ChannelFormat 渠道实际使用的消息格式
+func ChannelFormat(channel models.NotificationChannel) string {
+	if notify.ValidFormat(channel.Format) {
+		return channel.Format
+	}
+	return notify.DefaultFormat(channel.Type)
+}
+
+// LookupTemplate 查找事件在指定格式下生效的模板：先匹配格式，再匹配通用自定义模板，最后使用内置模板
+func LookupTemplate(event, format string) notify.Template {
+	var custom []models.NotificationTemplate
+	database.DB.Where("event = ? AND (format = ? OR format = '')", event, format).Find(&custom)
+	var generic *models.NotificationTemplate
+	for i := range custom {
+		if custom[i].Format == format {
+			return notify.Template{Title: custom[i].Title, Body: custom[i].Body}
 		}
-		return pushToWebhook(url, "CloudStream 测试", "通知服务配置成功！")
+		generic = &custom[i]
 	}
+	if generic != nil {
+		return notify.Template{Title: generic.Title, Body: generic.Body}
+	}
+	return notify.DefaultTemplates[event]
 }
 
-// 通用 Webhook 推送
-func pushToWebhook(url, title, content string) error {
-	payload := map[string]string{
-		"title":   title,
-		"body":    content,
-		"content": content,
-		"msg":     content,
+// RenderEvent 使用生效的模板渲染事件通知
+func RenderEvent(data notify.EventData, format string) (string, string, error) {
+	return notify.Render(LookupTemplate(data.Event, format), format, data)
+}
+
+// 同一账户的授权失败通知间隔，避免并发请求时重复告警
+const tokenFailureNotifyInterval = time.Hour
+
+var (
+	tokenFailureMu   sync.Mutex
+	tokenFailureSent = make(map[uint]time.Time)
+)
+
+// NotifyTokenFailure 账户获取访问令牌失败时发送通知，同一账户每小时最多一次
+func NotifyTokenFailure(account models.Account, err error) {
+	tokenFailureMu.Lock()
+	if last, ok := tokenFailureSent[account.ID]; ok && time.Since(last) < tokenFailureNotifyInterval {
+		tokenFailureMu.Unlock()
+		return
 	}
-	data, _ := json.Marshal(payload)
+	tokenFailureSent[account.ID] = time.Now()
+	tokenFailureMu.Unlock()
+
+	log.Warn().Err(err).Str("账户", account.Name).Msg("账户获取访问令牌失败")
+	SendEvent(notify.EventData{
+		Event:       notify.EventAccountTokenFailure,
+		AccountName: account.Name,
+		Message:     err.Error(),
+	})
+}
 
-	client := http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(data))
+// SendToChannel 通过指定渠道发送一条消息
+func SendToChannel(channel models.NotificationChannel, msg notify.Message) error {
+	notifier, err := notify.New(channel.Type, channel.Settings)
 	if err != nil {
-		log.Error().Err(err).Str("url", url).Msg("Webhook 发送失败")
 		return err
 	}
-	defer resp.Body.Close()
-	return nil
+	return notifier.Send(msg)
 }
 
-// Telegram 推送
-func pushToTelegram(token, chatID, text string) error {
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", token)
-	payload := map[string]string{
-		"chat_id":    chatID,
-		"text":       text,
-		"parse_mode": "Markdown",
+// recordDelivery 在渠道上记录最近一次投递结果
+func recordDelivery(channelID uint, sendErr error) {
+	status, lastError := "成功", ""
+	if sendErr != nil {
+		status, lastError = "失败", sendErr.Error()
 	}
-	data, _ := json.Marshal(payload)
+	database.DB.Model(&models.NotificationChannel{}).Where("id = ?", channelID).Updates(map[string]interface{}{
+		"last_sent_at": time.Now(),
+		"last_status":  status,
+		"last_error":   lastError,
+	})
+}
 
-	client := http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(apiURL, "application/json", bytes.NewBuffer(data))
+// SendTestNotification 使用尚未保存的渠道配置发送测试消息
+func SendTestNotification(channelType, settings, format string) error {
+	notifier, err := notify.New(channelType, settings)
 	if err != nil {
-		log.Error().Err(err).Msg("Telegram 发送失败")
 		return err
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("Telegram API 错误: %s", string(body))
+	if !notify.ValidFormat(format) {
+		format = notify.DefaultFormat(channelType)
 	}
-	return nil
+	data := &notify.EventData{Event: notify.EventTest, Message: "通知服务配置成功！"}
+	return notifier.Send(notify.Message{Event: notify.EventTest, Title: "CloudStream 测试", Body: data.Message, Format: format, Data: data})
 }
 
 // 读取日志
@@ -111,18 +181,18 @@ func ReadRecentLogs() (string, error) {
 	}
 
 	fileSize := stat.Size()
-	readSize := int64(50 * 1024) 
+	readSize := int64(50 * 1024)
 	if fileSize < readSize {
 		readSize = fileSize
 	}
 
 	offset := fileSize - readSize
 	buffer := make([]byte, readSize)
-	
+
 	_, err = file.ReadAt(buffer, offset)
 	if err != nil && err != io.EOF {
 		return "", err
 	}
 
 	return string(buffer), nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,228 @@
+package core
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"cloudstream/internal/notify"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	deliveryMaxAttempts  = 8
+	deliveryBaseBackoff  = 30 * time.Second
+	deliveryMaxBackoff   = time.Hour
+	deliveryPollInterval = 10 * time.Second
+	deliveryBatchSize    = 50
+	deliveryRetention    = 7 * 24 * time.Hour // 已发送记录的保留时长
+)
+
+// deliveryWake 有新消息入队时唤醒投递协程，缓冲为 1 以合并多次唤醒
+var deliveryWake = make(chan struct{}, 1)
+
+// workerStop 关闭后通知相关的后台协程 (发件箱投递、汇总) 退出，workerWG 等待它们结束
+var (
+	workerStop = make(chan struct{})
+	workerWG   sync.WaitGroup
+)
+
+func wakeDeliveryWorker() {
+	select {
+	case deliveryWake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueDelivery 将已渲染的消息写入发件箱
+func enqueueDelivery(channel models.NotificationChannel, msg notify.Message) error {
+	var payload string
+	if msg.Data != nil {
+		if data, err := json.Marshal(msg.Data); err == nil {
+			payload = string(data)
+		}
+	}
+	delivery := models.NotificationDelivery{
+		ChannelID:     channel.ID,
+		ChannelName:   channel.Name,
+		Event:         msg.Event,
+		Title:         msg.Title,
+		Body:          msg.Body,
+		Format:        msg.Format,
+		Payload:       payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		log.Error().Err(err).Str("渠道", channel.Name).Str("事件", msg.Event).Msg("写入通知发件箱失败")
+		return err
+	}
+	wakeDeliveryWorker()
+	return nil
+}
+
+// deliveryBackoff 第 n 次失败后的等待时间：30s、1m、2m ... 最长 1 小时
+func deliveryBackoff(attempts int) time.Duration {
+	d := deliveryBaseBackoff
+	for i := 1; i < attempts && d < deliveryMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > deliveryMaxBackoff {
+		d = deliveryMaxBackoff
+	}
+	return d
+}
+
+// attemptDelivery 投递一条消息并按结果更新状态
+func attemptDelivery(delivery models.NotificationDelivery) {
+	var channel models.NotificationChannel
+	err := database.DB.First(&channel, delivery.ChannelID).Error
+	// 渠道已删除或已停用时不再发送，直接放弃
+	discard := err != nil || !channel.Enabled
+	if err != nil {
+		err = fmt.Errorf("通知渠道已删除")
+	} else if !channel.Enabled {
+		err = fmt.Errorf("通知渠道已停用")
+	} else {
+		msg := notify.Message{
+			ID:     strconv.FormatUint(uint64(delivery.ID), 10),
+			Event:  delivery.Event,
+			Title:  delivery.Title,
+			Body:   delivery.Body,
+			Format: delivery.Format,
+		}
+		if delivery.Payload != "" {
+			var data notify.EventData
+			if json.Unmarshal([]byte(delivery.Payload), &data) == nil {
+				msg.Data = &data
+			}
+		}
+		err = SendToChannel(channel, msg)
+		recordDelivery(channel.ID, err)
+	}
+
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{"attempts": attempts}
+	switch {
+	case err == nil:
+		updates["status"] = models.DeliverySent
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+	case attempts >= deliveryMaxAttempts || discard:
+		updates["status"] = models.DeliveryDead
+		updates["last_error"] = err.Error()
+		log.Error().Err(err).Str("渠道", delivery.ChannelName).Str("事件", delivery.Event).Int("尝试次数", attempts).Msg("通知投递失败，已放弃重试")
+	default:
+		next := deliveryBackoff(attempts)
+		updates["next_attempt_at"] = now.Add(next)
+		updates["last_error"] = err.Error()
+		log.Warn().Err(err).Str("渠道", delivery.ChannelName).Str("事件", delivery.Event).Int("尝试次数", attempts).Dur("重试间隔", next).Msg("通知投递失败，稍后重试")
+	}
+	database.DB.Model(&models.NotificationDelivery{}).Where("id = ?", delivery.ID).Updates(updates)
+}
+
+// processOutbox 发送所有到期的待投递消息
+func processOutbox() {
+	for {
+		var due []models.NotificationDelivery
+		if err := database.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+			Order("id asc").Limit(deliveryBatchSize).Find(&due).Error; err != nil {
+			log.Error().Err(err).Msg("读取通知发件箱失败")
+			return
+		}
+		for _, delivery := range due {
+			select {
+			case <-workerStop:
+				return
+			default:
+			}
+			attemptDelivery(delivery)
+		}
+		if len(due) < deliveryBatchSize {
+			return
+		}
+	}
+}
+
+// StartDeliveryWorker 启动发件箱投递协程；重启后未完成的消息会继续发送
+func StartDeliveryWorker() {
+	workerWG.Add(1)
+	go func() {
+		defer workerWG.Done()
+		ticker := time.NewTicker(deliveryPollInterval)
+		defer ticker.Stop()
+		cleanup := time.NewTicker(time.Hour)
+		defer cleanup.Stop()
+		processOutbox()
+		for {
+			select {
+			case <-workerStop:
+				return
+			case <-deliveryWake:
+				processOutbox()
+			case <-ticker.C:
+				processOutbox()
+			case <-cleanup.C:
+				database.DB.Where("status = ? AND sent_at < ?", models.DeliverySent, time.Now().Add(-deliveryRetention)).
+					Delete(&models.NotificationDelivery{})
+			}
+		}
+	}()
+}
+
+// StopWorkers 停止通知相关的后台协程并等待其退出；超时返回 false
+func StopWorkers(ctx context.Context) bool {
+	close(workerStop)
+	done := make(chan struct{})
+	go func() {
+		workerWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Info().Msg("通知协程已停止")
+		return true
+	case <-ctx.Done():
+		log.Warn().Msg("等待通知协程结束超时")
+		return false
+	}
+}
+
+// RetryDelivery 将失败或已放弃的投递重新放回队列
+func RetryDelivery(id uint) error {
+	result := database.DB.Model(&models.NotificationDelivery{}).
+		Where("id = ? AND status <> ?", id, models.DeliverySent).
+		Updates(map[string]interface{}{
+			"status":          models.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("投递记录不存在或已发送成功")
+	}
+	wakeDeliveryWorker()
+	return nil
+}
+
+// RetryDeadDeliveries 重新投递所有已放弃的消息，返回数量
+func RetryDeadDeliveries() (int64, error) {
+	result := database.DB.Model(&models.NotificationDelivery{}).
+		Where("status = ?", models.DeliveryDead).
+		Updates(map[string]interface{}{
+			"status":          models.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error == nil && result.RowsAffected > 0 {
+		wakeDeliveryWorker()
+	}
+	return result.RowsAffected, result.Error
+}
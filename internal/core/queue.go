@@ -0,0 +1,240 @@
+package core
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"context"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"time"
+)
+
+// 任务运行的触发来源
+const (
+	RunSourceManual  = "manual"
+	RunSourceCron    = "cron"
+	RunSourceWebhook = "webhook"
+	RunSourceChain   = "dependency" // 上游任务结束后触发
+)
+
+// 排队状态
+const (
+	QueueStateRunning = "running"
+	QueueStateQueued  = "queued"
+)
+
+// QueueEntry 执行队列中的一次任务运行
+type QueueEntry struct {
+	TaskID     uint       `json:"taskId"`
+	TaskName   string     `json:"taskName"`
+	AccountID  uint       `json:"accountId"`
+	Source     string     `json:"source"`
+	SubPath    string     `json:"subPath,omitempty"`
+	State      string     `json:"state"`
+	Position   int        `json:"position,omitempty"` // 排队中的位置，从 1 开始
+	EnqueuedAt time.Time  `json:"enqueuedAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+
+	task  models.Task
+	scope *ScanScope
+	seq   uint64
+}
+
+// priority 手动触发 (包括外部 Webhook) 优先于定时触发
+func (e *QueueEntry) priority() int {
+	if e.Source == RunSourceCron {
+		return 0
+	}
+	return 1
+}
+
+// 以下状态均由 taskMutex 保护
+var (
+	pendingRuns []*QueueEntry
+	activeRuns  = make(map[uint]*QueueEntry)
+	queueSeq    uint64
+
+	// 全局与单账户并发上限，由 SetQueueLimits 更新；单账户为 0 表示不限制
+	maxTotalRuns   = 1
+	maxAccountRuns = 0
+)
+
+// EnqueueTask 将任务加入执行队列，并发额度允许时立即开始；任务已在运行或排队时返回 false
+func EnqueueTask(task models.Task, scope *ScanScope, source string) bool {
+	taskMutex.Lock()
+	if shuttingDown {
+		taskMutex.Unlock()
+		return false
+	}
+	if _, exists := runningTasks[task.ID]; exists || queuedIndex(task.ID) >= 0 {
+		taskMutex.Unlock()
+		return false
+	}
+	queueSeq++
+	entry := &QueueEntry{
+		TaskID:     task.ID,
+		TaskName:   task.Name,
+		AccountID:  task.AccountID,
+		Source:     source,
+		State:      QueueStateQueued,
+		EnqueuedAt: time.Now(),
+		task:       task,
+		scope:      scope,
+		seq:        queueSeq,
+	}
+	if scope != nil {
+		entry.SubPath = scope.RelPath
+	}
+	pendingRuns = append(pendingRuns, entry)
+	sort.SliceStable(pendingRuns, func(i, j int) bool {
+		if pendingRuns[i].priority() != pendingRuns[j].priority() {
+			return pendingRuns[i].priority() > pendingRuns[j].priority()
+		}
+		return pendingRuns[i].seq < pendingRuns[j].seq
+	})
+	dispatchLocked()
+	queued := entry.State == QueueStateQueued
+	taskMutex.Unlock()
+
+	if queued {
+		log.Info().Str("任务", task.Name).Str("来源", source).Msg("并发数已满，任务进入排队")
+		updateRunStatus(task.ID, scope, "排队中...", 0)
+	}
+	return true
+}
+
+// queuedIndex 返回任务在排队列表中的下标，不存在时返回 -1 (需持有 taskMutex)
+func queuedIndex(taskID uint) int {
+	for i, e := range pendingRuns {
+		if e.TaskID == taskID {
+			return i
+		}
+	}
+	return -1
+}
+
+// dispatchLocked 按优先级启动排队中的任务，直到达到并发上限 (需持有 taskMutex)
+func dispatchLocked() {
+	if len(pendingRuns) == 0 || shuttingDown {
+		return
+	}
+	maxTotal, perAccount := maxTotalRuns, maxAccountRuns
+	accountRuns := make(map[uint]int)
+	for _, e := range activeRuns {
+		accountRuns[e.AccountID]++
+	}
+	for i := 0; i < len(pendingRuns) && len(activeRuns) < maxTotal; {
+		entry := pendingRuns[i]
+		if perAccount > 0 && accountRuns[entry.AccountID] >= perAccount {
+			i++
+			continue
+		}
+		pendingRuns = append(pendingRuns[:i], pendingRuns[i+1:]...)
+		accountRuns[entry.AccountID]++
+
+		now := time.Now()
+		entry.State = QueueStateRunning
+		entry.StartedAt = &now
+		ctx, cancel := context.WithCancelCause(context.Background())
+		runningTasks[entry.TaskID] = cancel
+		activeRuns[entry.TaskID] = entry
+		runWG.Add(1)
+		go func(entry *QueueEntry) {
+			defer runWG.Done()
+			RunScanTask(ctx, entry.task, entry.scope)
+		}(entry)
+	}
+}
+
+// releaseTask 任务结束后释放并发额度并启动下一个排队任务
+func releaseTask(taskID uint) {
+	taskMutex.Lock()
+	defer taskMutex.Unlock()
+	delete(runningTasks, taskID)
+	delete(activeRuns, taskID)
+	dispatchLocked()
+}
+
+// SetQueueLimits 更新并发上限 (启动时及系统设置保存后调用)，并按新的上限重新检查排队任务；
+// 上限缓存在内存中，调度时无需在持有 taskMutex 的情况下读取数据库
+func SetQueueLimits(maxTotal, perAccount int) {
+	if maxTotal < 1 {
+		maxTotal = 1
+	}
+	if perAccount < 0 {
+		perAccount = 0
+	}
+	taskMutex.Lock()
+	defer taskMutex.Unlock()
+	maxTotalRuns, maxAccountRuns = maxTotal, perAccount
+	dispatchLocked()
+}
+
+// CancelQueuedTask 从队列中移除尚未开始的任务
+func CancelQueuedTask(taskID uint) bool {
+	taskMutex.Lock()
+	i := queuedIndex(taskID)
+	var scope *ScanScope
+	if i >= 0 {
+		scope = pendingRuns[i].scope
+		pendingRuns = append(pendingRuns[:i], pendingRuns[i+1:]...)
+	}
+	taskMutex.Unlock()
+	if i < 0 {
+		return false
+	}
+	updateRunStatus(taskID, scope, "已取消排队", 0)
+	return true
+}
+
+// IsTaskQueued 任务是否在排队等待执行
+func IsTaskQueued(taskID uint) bool {
+	taskMutex.Lock()
+	defer taskMutex.Unlock()
+	return queuedIndex(taskID) >= 0
+}
+
+// QueueSnapshot 返回正在运行和排队中的任务，运行中的在前
+func QueueSnapshot() []QueueEntry {
+	taskMutex.Lock()
+	defer taskMutex.Unlock()
+	list := make([]QueueEntry, 0, len(activeRuns)+len(pendingRuns))
+	for _, e := range activeRuns {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(*list[j].StartedAt) })
+	for i, e := range pendingRuns {
+		entry := *e
+		entry.Position = i + 1
+		list = append(list, entry)
+	}
+	return list
+}
+
+// refreshQueuedTasks 调度器刷新时同步排队任务的配置，移除已删除或已停用的任务 (需持有 taskMutex)
+func refreshQueuedTasks() {
+	for _, e := range append([]*QueueEntry(nil), pendingRuns...) {
+		var task models.Task
+		if err := database.DB.First(&task, e.TaskID).Error; err != nil {
+			syncQueuedTaskLocked(e.TaskID, nil)
+			continue
+		}
+		syncQueuedTaskLocked(e.TaskID, &task)
+	}
+}
+
+// syncQueuedTaskLocked 用最新配置更新排队中的任务，task 为 nil 或已停用时移出队列 (需持有 taskMutex)
+func syncQueuedTaskLocked(taskID uint, task *models.Task) {
+	i := queuedIndex(taskID)
+	if i < 0 {
+		return
+	}
+	if task == nil || !task.Enabled {
+		pendingRuns = append(pendingRuns[:i], pendingRuns[i+1:]...)
+		return
+	}
+	e := pendingRuns[i]
+	e.task = *task
+	e.TaskName = task.Name
+	e.AccountID = task.AccountID
+}
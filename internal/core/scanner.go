@@ -4,13 +4,14 @@ import (
 	"cloudstream/internal/auth"
 	"cloudstream/internal/database"
 	"cloudstream/internal/models"
+	"cloudstream/internal/notify"
 	"cloudstream/internal/pan123"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -28,6 +29,9 @@ import (
 type FileTracker struct {
 	sync.RWMutex
 	files map[string]struct{}
+	added []string    // 本次扫描新生成的 STRM 文件
+	fresh []string    // 尚未写入数据库的文件
+	temps tempFileSet // 本次扫描写入时残留的临时文件
 }
 
 func NewFileTracker() *FileTracker {
@@ -38,7 +42,26 @@ func NewFileTracker() *FileTracker {
 
 func (t *FileTracker) Add(path string) {
 	t.Lock()
-	t.files[path] = struct{}{}
+	if _, ok := t.files[path]; !ok {
+		t.files[path] = struct{}{}
+		t.fresh = append(t.fresh, path)
+	}
+	t.Unlock()
+}
+
+// TakeFresh 取出上次调用之后新记录的文件，用于分批写入数据库
+func (t *FileTracker) TakeFresh() []string {
+	t.Lock()
+	defer t.Unlock()
+	fresh := t.fresh
+	t.fresh = nil
+	return fresh
+}
+
+// restoreFresh 写入数据库失败时放回待写入列表
+func (t *FileTracker) restoreFresh(paths []string) {
+	t.Lock()
+	t.fresh = append(paths, t.fresh...)
 	t.Unlock()
 }
 
@@ -65,24 +88,142 @@ func (t *FileTracker) Count() int {
 	return len(t.files)
 }
 
-func RunScanTask(ctx context.Context, task models.Task) {
-	// 更新状态为运行中
-	database.DB.Model(&models.Task{}).Where("id = ?", task.ID).Updates(map[string]interface{}{
-		"last_run_status": "扫描中...",
-		"processed_count": 0,
-	})
+// MarkAdded 记录本次扫描新增的文件
+func (t *FileTracker) MarkAdded(path string) {
+	t.Lock()
+	t.added = append(t.added, path)
+	t.Unlock()
+}
+
+func (t *FileTracker) Added() []string {
+	t.RLock()
+	defer t.RUnlock()
+	added := append([]string(nil), t.added...)
+	sort.Strings(added)
+	return added
+}
+
+// addedListLimit 新增媒体通知中最多列出的标题数
+const addedListLimit = 20
+
+// eventFileLimit 通知事件中保留的文件路径数，避免大批量变化时发件箱和 Webhook 负载过大
+const eventFileLimit = 200
+
+// limitEventFiles 截取事件中的文件列表，返回是否被截断
+func limitEventFiles(files []string) ([]string, bool) {
+	if len(files) > eventFileLimit {
+		return files[:eventFileLimit], true
+	}
+	return files, false
+}
+
+// groupAddedMedia 将新增的 STRM 文件按所在目录 (相对任务本地路径) 分组，返回分组及未列出的数量
+func groupAddedMedia(root string, files []string) ([]notify.FileGroup, int) {
+	var groups []notify.FileGroup
+	index := make(map[string]int)
+	listed := 0
+	for _, file := range files {
+		if listed >= addedListLimit {
+			break
+		}
+		folder, err := filepath.Rel(root, filepath.Dir(file))
+		if err != nil || folder == "." {
+			folder = "/"
+		}
+		title := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		i, ok := index[folder]
+		if !ok {
+			i = len(groups)
+			index[folder] = i
+			groups = append(groups, notify.FileGroup{Folder: folder})
+		}
+		groups[i].Titles = append(groups[i].Titles, title)
+		listed++
+	}
+	return groups, len(files) - listed
+}
+
+// ScanErrors 记录扫描失败的目录；其他目录照常更新，失败目录下的文件不参与同步删除
+type ScanErrors struct {
+	sync.Mutex
+	failed     atomic.Bool
+	messages   []string
+	dirs       []string // 失败目录相对任务源目录的路径
+	localPaths []string // 失败目录对应的本地路径
+}
+
+func (e *ScanErrors) Record(relPath, localPath, msg string) {
+	e.Lock()
+	e.messages = append(e.messages, msg)
+	e.dirs = append(e.dirs, relPath)
+	e.localPaths = append(e.localPaths, localPath)
+	e.Unlock()
+	e.failed.Store(true)
+}
 
+func (e *ScanErrors) FailedDirs() []string {
+	e.Lock()
+	defer e.Unlock()
+	return append([]string(nil), e.dirs...)
+}
+
+func (e *ScanErrors) FailedLocalPaths() []string {
+	e.Lock()
+	defer e.Unlock()
+	return append([]string(nil), e.localPaths...)
+}
+
+func (e *ScanErrors) Failed() bool {
+	return e.failed.Load()
+}
+
+func (e *ScanErrors) Messages() []string {
+	e.Lock()
+	defer e.Unlock()
+	return append([]string(nil), e.messages...)
+}
+
+// ScanScope 限定一次扫描的范围，为 nil 时扫描任务的完整源目录
+type ScanScope struct {
+	FolderID   string // 子目录在云盘中的 ID (OpenList 为完整路径)
+	RelPath    string // 子目录相对任务源目录的路径，例如 "TV/Show/Season 2"
+	SyncDelete bool   // 是否清理该子目录范围内的失效文件
+}
+
+// localDir 子目录对应的本地目录
+func (s *ScanScope) localDir(task models.Task) string {
+	if s == nil || s.RelPath == "" {
+		return task.LocalPath
+	}
+	return filepath.Join(task.LocalPath, filepath.FromSlash(s.RelPath))
+}
+
+func RunScanTask(ctx context.Context, task models.Task, scope *ScanScope) {
+	startedAt := time.Now()
+	// 更新状态为运行中；子目录扫描不重置整个任务的处理文件数
+	if scope != nil {
+		database.DB.Model(&models.Task{}).Where("id = ?", task.ID).Update("last_run_status", "扫描中...")
+	} else {
+		database.DB.Model(&models.Task{}).Where("id = ?", task.ID).Updates(map[string]interface{}{
+			"last_run_status": "扫描中...",
+			"processed_count": 0,
+		})
+	}
+
+	// outcome 本次运行的结果，完整扫描结束后据此触发下游任务；子目录扫描 (如 Webhook 触发) 不触发下游流水线
+	outcome := RunOutcomeFailure
 	defer func() {
-		taskMutex.Lock()
-		delete(runningTasks, task.ID)
-		taskMutex.Unlock()
+		releaseTask(task.ID)
 		log.Info().Str("任务", task.Name).Msg("任务控制权已释放")
+		if scope == nil {
+			triggerDependents(task, outcome)
+		}
 	}()
 
 	var account models.Account
 	if err := database.DB.First(&account, task.AccountID).Error; err != nil {
 		log.Error().Err(err).Str("任务", task.Name).Uint("accountID", task.AccountID).Msg("任务启动失败：找不到关联的云账户")
-		updateTaskStatus(task.ID, "失败: 账户丢失", 0)
+		updateRunStatus(task.ID, scope, "失败: 账户丢失", 0)
 		return
 	}
 
@@ -90,30 +231,64 @@ func RunScanTask(ctx context.Context, task models.Task) {
 	if threads < 1 { threads = 1 }
 	if threads > 16 { threads = 16 }
 
-	log.Info().Str("任务", task.Name).Str("账户", account.Name).Int("线程数", threads).Msg("开始执行任务")
-	client := pan123.NewClient(account)
+	logEvent := log.Info().Str("任务", task.Name).Str("账户", account.Name).Int("线程数", threads)
+	if scope != nil {
+		logEvent = logEvent.Str("子目录", scope.RelPath)
+	}
+	logEvent.Msg("开始执行任务")
+	// 接口调用频率由账户共享的令牌桶控制，与文件浏览、播放共用额度
+	client := pan123.NewClient(account).WithContext(ctx)
 	strmExtMap := parseExtensions(task.StrmExtensions)
 	metaExtMap := parseExtensions(task.MetaExtensions)
 
 	tracker := NewFileTracker()
-	var hasError atomic.Bool
-	hasError.Store(false)
+	scanErrs := &ScanErrors{}
+	subPath := ""
+	if scope != nil {
+		subPath = scope.RelPath
+	}
+	cp := loadCheckpoint(task.ID, subPath)
+	if len(cp.resumed) > 0 {
+		log.Info().Str("任务", task.Name).Int("已完成目录", len(cp.resumed)).Msg("从上次的断点继续扫描")
+	}
+
+	// flush 先写入已处理文件的记录，再保存断点，保证断点中已完成的目录在数据库中都有记录；
+	// 运行结果被丢弃时 (源目录变更或任务删除) 不再写入，避免旧记录和断点在清理后重新出现
+	flush := func() error {
+		if errors.Is(context.Cause(ctx), errRunDiscarded) {
+			return nil
+		}
+		fresh := tracker.TakeFresh()
+		if err := updateFileRecordsOptimized(task.ID, fresh); err != nil {
+			tracker.restoreFresh(fresh)
+			return err
+		}
+		cp.save(scanErrs.FailedDirs())
+		return nil
+	}
 
 	var wg sync.WaitGroup
 	workerPool := make(chan struct{}, threads)
-	rateLimiter := time.NewTicker(time.Second / time.Duration(threads))
-	defer rateLimiter.Stop()
 
-	// --- 进度自动更新协程 ---
+	// --- 进度自动更新与断点保存协程 ---
 	progressTicker := time.NewTicker(2 * time.Second)
+	checkpointTicker := time.NewTicker(checkpointSaveInterval)
 	progressCtx, cancelProgress := context.WithCancel(context.Background())
+	progressDone := make(chan struct{})
 	defer cancelProgress()
 	go func() {
+		defer close(progressDone)
 		for {
 			select {
 			case <-progressTicker.C:
-				count := tracker.Count()
-				database.DB.Model(&models.Task{}).Where("id = ?", task.ID).Update("processed_count", count)
+				if scope == nil {
+					count := tracker.Count()
+					database.DB.Model(&models.Task{}).Where("id = ?", task.ID).Update("processed_count", count)
+				}
+			case <-checkpointTicker.C:
+				if err := flush(); err != nil {
+					log.Error().Err(err).Str("任务", task.Name).Msg("保存扫描断点失败")
+				}
 			case <-progressCtx.Done():
 				return
 			}
@@ -125,40 +300,131 @@ func RunScanTask(ctx context.Context, task models.Task) {
 	if account.Type == models.AccountTypeOpenList && (startFolderID == "0" || startFolderID == "") {
 		startFolderID = "/"
 	}
+	cloudBase, localBase := "", scope.localDir(task)
+	syncDelete := task.SyncDelete
+	if scope != nil {
+		startFolderID = scope.FolderID
+		cloudBase = scope.RelPath
+		syncDelete = task.SyncDelete && scope.SyncDelete
+	}
 
-	scanDirectoryRecursive(ctx, client, task, account.Type, startFolderID, "", task.LocalPath, strmExtMap, metaExtMap, &wg, workerPool, rateLimiter, tracker, &hasError)
+	scanDirectoryRecursive(ctx, client, task, account.Type, startFolderID, cloudBase, localBase, strmExtMap, metaExtMap, &wg, workerPool, tracker, scanErrs, cp, nil)
 
 	wg.Wait()
+	// 所有写入已结束，清理本次扫描残留的临时文件
+	if removed := tracker.temps.cleanup(); removed > 0 {
+		log.Info().Int("数量", removed).Msg("已清理残留的临时文件")
+	}
 	progressTicker.Stop() // 停止进度更新
+	checkpointTicker.Stop()
+	cancelProgress()
+	<-progressDone
+
+	event := notify.EventData{
+		TaskID:      task.ID,
+		TaskName:    task.Name,
+		AccountName: account.Name,
+		StartedAt:   startedAt,
+	}
+	if scope != nil {
+		event.SubPath = scope.RelPath
+	}
+	finish := func(name, status string) {
+		event.Event = name
+		event.Status = status
+		event.ProcessedCount = tracker.Count()
+		event.FinishedAt = time.Now()
+		event.Duration = event.FinishedAt.Sub(startedAt)
+		SendEvent(event)
+	}
 
 	select {
 	case <-ctx.Done():
-		log.Warn().Str("任务", task.Name).Msg("任务已被手动停止")
-		updateTaskStatus(task.ID, "用户手动停止", tracker.Count())
-		SendNotification("任务停止", fmt.Sprintf("任务 '%s' 已被手动停止", task.Name))
+		status := "用户手动停止"
+		if isShuttingDown() {
+			status = StatusInterruptedByShutdown
+		} else if cause := context.Cause(ctx); errors.Is(cause, errTaskChanged) || errors.Is(cause, errRunDiscarded) {
+			status = cause.Error() + "，已停止"
+		}
+		log.Warn().Str("任务", task.Name).Str("状态", status).Msg("任务已被停止")
+		if err := flush(); err != nil {
+			log.Error().Err(err).Str("任务", task.Name).Msg("保存扫描断点失败")
+		}
+		outcome = RunOutcomeStopped
+		updateRunStatus(task.ID, scope, status, tracker.Count())
+		finish(notify.EventTaskStopped, status)
 	default:
-		if hasError.Load() {
-			msg := fmt.Sprintf("任务 '%s' 执行过程中出现错误，为防止误删，已跳过数据库更新和本地清理。", task.Name)
-			log.Error().Msg(msg)
-			updateTaskStatus(task.ID, "异常中止", tracker.Count())
-			SendNotification("任务异常", msg)
+		if err := updateFileRecordsOptimized(task.ID, tracker.TakeFresh()); err != nil {
+			log.Error().Err(err).Msg("更新数据库文件记录失败")
+			updateRunStatus(task.ID, scope, "更新DB失败", tracker.Count())
 			return
 		}
-
-		// 只有完全无错时才更新 DB
-		if err := updateFileRecordsOptimized(task.ID, tracker); err != nil {
-			log.Error().Err(err).Msg("更新数据库文件记录失败")
-			updateTaskStatus(task.ID, "更新DB失败", tracker.Count())
-		} else {
-			if task.SyncDelete {
-				performSafeSyncDeleteOptimized(task.ID, tracker)
-				cleanEmptyDirs(task.LocalPath)
+		var deleted []string
+		if syncDelete {
+			prefix := ""
+			if scope != nil {
+				prefix = localBase
+			}
+			// 扫描失败的目录和从断点跳过的目录不做清理
+			protected := append(scanErrs.FailedLocalPaths(), cp.skippedPaths()...)
+			deleted = performSafeSyncDeleteOptimized(task.ID, tracker, prefix, protected)
+			cleanEmptyDirs(localBase)
+		}
+		added := tracker.Added()
+		event.AddedCount = len(added)
+		event.DeletedCount = len(deleted)
+		event.AddedGroups, event.AddedMore = groupAddedMedia(task.LocalPath, added)
+		var addedCut, deletedCut bool
+		event.AddedFiles, addedCut = limitEventFiles(added)
+		event.DeletedFiles, deletedCut = limitEventFiles(deleted)
+		event.FilesTruncated = addedCut || deletedCut
+
+		if scanErrs.Failed() {
+			cp.save(scanErrs.FailedDirs())
+			status := "部分失败"
+			if isFailedRoot(scanErrs.FailedDirs(), cloudBase) {
+				status = "异常中止"
 			}
+			log.Error().Str("任务", task.Name).Strs("失败目录", scanErrs.FailedDirs()).Msg("部分目录扫描失败，其余目录已正常更新，下次执行时将从断点继续")
+			updateRunStatus(task.ID, scope, status, tracker.Count())
+			event.Errors = scanErrs.Messages()
+			finish(notify.EventTaskFailure, status)
+		} else {
+			cp.clear()
 			log.Info().Str("任务", task.Name).Int("总文件", tracker.Count()).Msg("任务执行完毕")
-			updateTaskStatus(task.ID, "已完成", tracker.Count())
-			SendNotification("任务完成", fmt.Sprintf("任务 '%s' 已执行完毕，共处理 %d 个文件", task.Name, tracker.Count()))
+			outcome = RunOutcomeSuccess
+			updateRunStatus(task.ID, scope, "已完成", tracker.Count())
+			finish(notify.EventTaskSuccess, "已完成")
+		}
+		if event.AddedCount > 0 {
+			finish(notify.EventFilesAdded, event.Status)
+		}
+		if event.DeletedCount > 0 {
+			finish(notify.EventFilesDeleted, event.Status)
+		}
+		if err := refreshMediaLibrary(task, changedDirs(added, deleted)); err != nil {
+			log.Error().Err(err).Str("任务", task.Name).Msg("媒体库刷新失败")
+		}
+	}
+}
+
+// isFailedRoot 扫描起点本身失败时视为整体失败
+func isFailedRoot(failedDirs []string, root string) bool {
+	for _, d := range failedDirs {
+		if d == root {
+			return true
 		}
 	}
+	return false
+}
+
+// updateRunStatus 写入一次运行的状态；子目录扫描只在状态中标注子目录，不覆盖整个任务的处理文件数
+func updateRunStatus(id uint, scope *ScanScope, status string, count int) {
+	if scope == nil {
+		updateTaskStatus(id, status, count)
+		return
+	}
+	database.DB.Model(&models.Task{}).Where("id = ?", id).Update("last_run_status", fmt.Sprintf("%s (子目录 %s)", status, scope.RelPath))
 }
 
 func updateTaskStatus(id uint, status string, count int) {
@@ -196,12 +462,11 @@ func cleanEmptyDirs(root string) {
 	}
 }
 
-func updateFileRecordsOptimized(taskID uint, tracker *FileTracker) error {
-	log.Info().Msg("正在更新数据库文件记录...")
-	paths := tracker.Keys()
+func updateFileRecordsOptimized(taskID uint, paths []string) error {
 	if len(paths) == 0 {
 		return nil
 	}
+	log.Info().Int("数量", len(paths)).Msg("正在更新数据库文件记录...")
 
 	batchSize := 500
 	records := make([]models.TaskFile, 0, batchSize)
@@ -226,9 +491,12 @@ func updateFileRecordsOptimized(taskID uint, tracker *FileTracker) error {
 	})
 }
 
-func performSafeSyncDeleteOptimized(taskID uint, currentScanTracker *FileTracker) {
+// performSafeSyncDeleteOptimized 删除本次扫描中不再存在的历史文件，返回已删除的本地文件路径
+// prefix 不为空时只处理该目录下的记录 (子目录扫描)，protected 中目录下的记录保持不变
+func performSafeSyncDeleteOptimized(taskID uint, currentScanTracker *FileTracker, prefix string, protected []string) []string {
 	log.Info().Uint("taskID", taskID).Msg("开始执行安全清理...")
 
+	var deletedFiles []string
 	deletedCount := 0
 	dbDeletedCount := 0
 	var lastID uint = 0
@@ -250,11 +518,18 @@ func performSafeSyncDeleteOptimized(taskID uint, currentScanTracker *FileTracker
 
 		for _, record := range historyFiles {
 			lastID = record.ID
+			if prefix != "" && !isUnderDir(record.FilePath, prefix) {
+				continue
+			}
+			if underAnyDir(record.FilePath, protected) {
+				continue
+			}
 
 			if !currentScanTracker.Has(record.FilePath) {
 				if err := os.Remove(record.FilePath); err == nil || os.IsNotExist(err) {
 					log.Info().Str("文件", record.FilePath).Msg("同步删除本地失效文件")
 					deletedCount++
+					deletedFiles = append(deletedFiles, record.FilePath)
 				}
 				idsToDelete = append(idsToDelete, record.ID)
 			}
@@ -270,19 +545,43 @@ func performSafeSyncDeleteOptimized(taskID uint, currentScanTracker *FileTracker
 	if deletedCount > 0 {
 		log.Info().Int("删除文件数", deletedCount).Int("删除记录数", dbDeletedCount).Msg("清理完成")
 	}
+	return deletedFiles
 }
 
-func scanDirectoryRecursive(ctx context.Context, client *pan123.Client, task models.Task, accountType, folderID, currentCloudPath, localBasePath string, strmExtMap, metaExtMap map[string]bool, wg *sync.WaitGroup, pool chan struct{}, limiter *time.Ticker, tracker *FileTracker, hasError *atomic.Bool) {
-	if hasError.Load() {
-		return
+func isUnderDir(file, dir string) bool {
+	return strings.HasPrefix(file, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func underAnyDir(file string, dirs []string) bool {
+	for _, d := range dirs {
+		if isUnderDir(file, d) {
+			return true
+		}
 	}
+	return false
+}
 
+// scanDirectoryRecursive 扫描一个目录：列表失败时记录失败目录并跳过该子树，其余目录继续扫描；
+// 目录下所有文件和子目录处理完毕后记录到断点，上次已完成的目录直接跳过
+func scanDirectoryRecursive(ctx context.Context, client *pan123.Client, task models.Task, accountType, folderID, currentCloudPath, localBasePath string, strmExtMap, metaExtMap map[string]bool, wg *sync.WaitGroup, pool chan struct{}, tracker *FileTracker, scanErrs *ScanErrors, cp *scanCheckpoint, parent *dirNode) {
 	select {
 	case <-ctx.Done():
 		return
 	default:
 	}
 
+	node := newDirNode(currentCloudPath, parent)
+	if cp.isResumed(currentCloudPath) {
+		cp.skip(localBasePath)
+		node.done(cp)
+		return
+	}
+	fail := func(msg string) {
+		scanErrs.Record(currentCloudPath, localBasePath, msg)
+		node.failed.Store(true)
+		node.done(cp)
+	}
+
 	var (
 		folderIDInt int64
 		err     error
@@ -293,33 +592,31 @@ func scanDirectoryRecursive(ctx context.Context, client *pan123.Client, task mod
 		folderIDInt, err = strconv.ParseInt(folderID, 10, 64)
 		if err != nil {
 			log.Error().Err(err).Str("任务", task.Name).Str("目录ID", folderID).Msg("无效的目录ID")
-			hasError.Store(true) 
+			fail(fmt.Sprintf("无效的目录ID: %s", folderID))
 			return
 		}
 	}
 
 	var lastFileId int64 = 0
 	for {
-		if hasError.Load() { return } 
 		select {
 		case <-ctx.Done():
 			return
 		default:
 		}
-		<-limiter.C
 
 		if accountType == models.AccountType123Pan {
+			// 限流、授权失效等可恢复的错误已在客户端内按退避策略重试
 			files, nextLastFileId, err := client.ListFiles(folderIDInt, 100, lastFileId, "")
 			if err != nil {
-				if strings.Contains(err.Error(), "code: 429") {
-					time.Sleep(3 * time.Second)
-					files, nextLastFileId, err = client.ListFiles(folderIDInt, 100, lastFileId, "")
-				}
-				if err != nil {
-					log.Error().Err(err).Str("任务", task.Name).Msg("扫描目录失败（123云盘）")
-					hasError.Store(true) 
+				select {
+				case <-ctx.Done():
 					return
+				default:
 				}
+				log.Error().Err(err).Str("任务", task.Name).Msg("扫描目录失败（123云盘）")
+				fail(fmt.Sprintf("扫描目录失败 /%s: %v", currentCloudPath, err))
+				return
 			}
 			for _, file := range files {
 				if file.Trashed == 0 {
@@ -333,8 +630,13 @@ func scanDirectoryRecursive(ctx context.Context, client *pan123.Client, task mod
 		} else if accountType == models.AccountTypeOpenList {
 			files, err := client.ListOpenListDirectory(folderID)
 			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
 				log.Error().Err(err).Str("任务", task.Name).Str("路径", folderID).Msg("扫描目录失败（OpenList）")
-				hasError.Store(true) 
+				fail(fmt.Sprintf("扫描目录失败 %s: %v", folderID, err))
 				return
 			}
 			allFiles = append(allFiles, files...)
@@ -342,9 +644,8 @@ func scanDirectoryRecursive(ctx context.Context, client *pan123.Client, task mod
 		}
 	}
 
+	node.pending.Add(int32(len(allFiles)))
 	for _, item := range allFiles {
-		if hasError.Load() { return }
-
 		currentItem := item
 		itemCloudPath := path.Join(currentCloudPath, currentItem.FileName)
 		nextLocalPath := filepath.Join(localBasePath, currentItem.FileName)
@@ -366,25 +667,18 @@ func scanDirectoryRecursive(ctx context.Context, client *pan123.Client, task mod
 				case pool <- struct{}{}:
 				}
 				defer func() { <-pool }()
-				scanDirectoryRecursive(ctx, client, task, accountType, nextFolderID, itemCloudPath, nextLocalPath, strmExtMap, metaExtMap, wg, pool, limiter, tracker, hasError)
+				scanDirectoryRecursive(ctx, client, task, accountType, nextFolderID, itemCloudPath, nextLocalPath, strmExtMap, metaExtMap, wg, pool, tracker, scanErrs, cp, node)
 			}()
 		} else {
 			wg.Add(1)
 			go func(fileToProcess pan123.FileInfo, cloudRelPath string) {
 				defer wg.Done()
-				if hasError.Load() { return }
-
 				select {
 				case <-ctx.Done():
 					return
 				case pool <- struct{}{}:
 				}
 				defer func() { <-pool }()
-				select {
-				case <-ctx.Done():
-					return
-				case <-limiter.C:
-				}
 
 				ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fileToProcess.FileName), "."))
 				if strmExtMap[ext] {
@@ -396,11 +690,18 @@ func scanDirectoryRecursive(ctx context.Context, client *pan123.Client, task mod
 					} else {
 						downloadIdentity = fileToProcess.FileId
 					}
-					downloadAndSaveMetaFile(client, task, downloadIdentity, fileToProcess.FileName, localBasePath, tracker)
+					downloadAndSaveMetaFile(ctx, client, task, downloadIdentity, fileToProcess, localBasePath, tracker)
+				}
+				select {
+				case <-ctx.Done():
+					return // 中途停止的文件不计入完成，续跑时重新处理所在目录
+				default:
 				}
+				node.done(cp)
 			}(currentItem, itemCloudPath)
 		}
 	}
+	node.done(cp)
 }
 
 func createStrmFile(client *pan123.Client, task models.Task, file pan123.FileInfo, cloudRelPath string, localBasePath string, tracker *FileTracker) {
@@ -410,10 +711,10 @@ func createStrmFile(client *pan123.Client, task models.Task, file pan123.FileInf
 
 	tracker.Add(localFilePath)
 
-	if !task.Overwrite {
-		if _, err := os.Stat(localFilePath); err == nil {
-			return
-		}
+	_, statErr := os.Stat(localFilePath)
+	existed := statErr == nil
+	if !task.Overwrite && existed {
+		return
 	}
 
 	baseURL := client.Account.StrmBaseURL
@@ -479,12 +780,18 @@ func createStrmFile(client *pan123.Client, task models.Task, file pan123.FileInf
 		return
 	}
 
-	if err := os.WriteFile(localFilePath, []byte(streamURL), 0644); err == nil {
-		log.Info().Str("文件", strmFileName).Msg("已生成 STRM 文件")
+	if err := writeFileAtomic(localFilePath, strings.NewReader(streamURL), 0, &tracker.temps); err != nil {
+		log.Error().Err(err).Str("文件", strmFileName).Msg("写入 STRM 文件失败")
+		return
+	}
+	log.Info().Str("文件", strmFileName).Msg("已生成 STRM 文件")
+	if !existed {
+		tracker.MarkAdded(localFilePath)
 	}
 }
 
-func downloadAndSaveMetaFile(client *pan123.Client, task models.Task, identity interface{}, fileName string, localBasePath string, tracker *FileTracker) {
+func downloadAndSaveMetaFile(ctx context.Context, client *pan123.Client, task models.Task, identity interface{}, file pan123.FileInfo, localBasePath string, tracker *FileTracker) {
+	fileName := file.FileName
 	localFilePath := filepath.Join(localBasePath, fileName)
 
 	tracker.Add(localFilePath)
@@ -499,25 +806,29 @@ func downloadAndSaveMetaFile(client *pan123.Client, task models.Task, identity i
 		log.Error().Err(err).Str("文件", fileName).Msg("获取元数据链接失败")
 		return
 	}
-	resp, err := http.Get(downloadURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		log.Error().Err(err).Str("文件", fileName).Msg("下载元数据文件失败")
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
+		log.Error().Int("状态码", resp.StatusCode).Str("文件", fileName).Msg("下载元数据文件失败")
 		return
 	}
 	if err := os.MkdirAll(filepath.Dir(localFilePath), 0755); err != nil {
 		return
 	}
-	outFile, err := os.Create(localFilePath)
-	if err != nil {
+	// 先写入临时文件，下载中断或大小不符时不会留下残缺文件
+	if err := writeFileAtomic(localFilePath, resp.Body, file.Size, &tracker.temps); err != nil {
+		log.Error().Err(err).Str("文件", fileName).Msg("保存元数据文件失败")
 		return
 	}
-	defer outFile.Close()
-	if _, err := io.Copy(outFile, resp.Body); err == nil {
-		log.Info().Str("文件", fileName).Msg("已下载元数据文件")
-	}
+	log.Info().Str("文件", fileName).Msg("已下载元数据文件")
 }
 
 func parseExtensions(extStr string) map[string]bool {
@@ -4,82 +4,235 @@ import (
 	"cloudstream/internal/database"
 	"cloudstream/internal/models"
 	"context"
+	"errors"
 	"github.com/go-co-op/gocron"
 	"github.com/rs/zerolog/log"
+	"strconv"
 	"sync"
 	"time"
 )
 
 var (
 	MainScheduler *gocron.Scheduler
-	runningTasks  = make(map[uint]context.CancelFunc)
+	runningTasks  = make(map[uint]context.CancelCauseFunc)
 	taskMutex     sync.Mutex
+
+	// scheduledSpecs 已注册到调度器的任务及其 Cron 表达式 (含时区前缀)
+	scheduledSpecs = make(map[uint]string)
+	scheduleMutex  sync.Mutex
+
+	// runWG 正在运行的扫描任务；shuttingDown 置位后不再接受新的运行 (由 taskMutex 保护)
+	runWG        sync.WaitGroup
+	shuttingDown bool
+)
+
+// 服务停止或重启导致任务中断时的状态
+const (
+	StatusInterruptedByShutdown = "服务停止，已中断"
+	StatusInterruptedByRestart  = "服务重启，已中断"
 )
 
 func InitScheduler() {
-	MainScheduler = gocron.NewScheduler(time.UTC)
+	resetStaleTaskStatus()
+	setting := database.GetSystemSetting()
+	SetQueueLimits(setting.MaxConcurrentTasks, setting.MaxTasksPerAccount)
+	MainScheduler = gocron.NewScheduler(SchedulerLocation())
 	log.Info().Msg("定时任务调度器已初始化")
 	RefreshScheduler()
 	MainScheduler.StartAsync()
 	log.Info().Msg("调度器已启动")
 }
 
-func RefreshScheduler() {
+// resetStaleTaskStatus 上次停机时未能正常结束的任务仍停留在运行或排队状态，启动时重置；
+// 它们的断点会保留，下次执行时继续
+func resetStaleTaskStatus() {
+	result := database.DB.Model(&models.Task{}).
+		Where("last_run_status IN ? OR last_run_status LIKE ?", []string{"扫描中...", "排队中..."}, "排队中... (子目录 %").
+		Update("last_run_status", StatusInterruptedByRestart)
+	if result.Error != nil {
+		log.Error().Err(result.Error).Msg("重置中断任务的状态失败")
+	} else if result.RowsAffected > 0 {
+		log.Warn().Int64("count", result.RowsAffected).Msg("已重置上次停机时中断的任务状态")
+	}
+}
+
+// Shutdown 停止调度器：不再触发定时任务，清空排队，停止正在运行的任务并等待其写入最终状态；
+// ctx 到期时不再等待，返回 false
+func Shutdown(ctx context.Context) bool {
+	if MainScheduler != nil {
+		MainScheduler.Stop()
+	}
+
 	taskMutex.Lock()
-	for id, cancel := range runningTasks {
-		cancel()
-		delete(runningTasks, id)
+	shuttingDown = true
+	queued := pendingRuns
+	pendingRuns = nil
+	for _, cancel := range runningTasks {
+		cancel(nil)
 	}
+	running := len(runningTasks)
 	taskMutex.Unlock()
 
-	MainScheduler.Clear()
+	for _, e := range queued {
+		updateRunStatus(e.TaskID, e.scope, "已取消排队", 0)
+	}
+	if running > 0 {
+		log.Info().Int("count", running).Msg("正在停止运行中的任务...")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Info().Msg("调度器已停止")
+		return true
+	case <-ctx.Done():
+		log.Warn().Msg("等待任务结束超时，部分任务可能未写入最终状态")
+		return false
+	}
+}
 
+// isShuttingDown 服务是否正在停机
+func isShuttingDown() bool {
+	taskMutex.Lock()
+	defer taskMutex.Unlock()
+	return shuttingDown
+}
+
+// RefreshScheduler 将调度器与数据库中已启用的任务对比，只增删有变化的定时任务，不影响正在运行的任务
+func RefreshScheduler() {
 	var tasks []models.Task
 	if err := database.DB.Where("enabled = ?", true).Find(&tasks).Error; err != nil {
 		log.Error().Err(err).Msg("从数据库加载任务失败")
 		return
 	}
-	log.Info().Int("count", len(tasks)).Msg("发现已启用的任务，正在添加到调度器...")
-
-	for _, dbTask := range tasks {
-		t := dbTask
-		_, err := MainScheduler.Cron(t.Cron).Do(func() {
-			taskMutex.Lock()
-			if _, exists := runningTasks[t.ID]; exists {
-				taskMutex.Unlock()
-				log.Warn().Str("task", t.Name).Msg("任务已在运行，跳过此次定时执行")
-				return
-			}
-			ctx, cancel := context.WithCancel(context.Background())
-			runningTasks[t.ID] = cancel
-			taskMutex.Unlock()
-
-			RunScanTask(ctx, t)
-		})
-
-		if err != nil {
-			log.Error().Err(err).Str("task", t.Name).Msg("添加任务到调度器失败")
+
+	taskMutex.Lock()
+	refreshQueuedTasks()
+	taskMutex.Unlock()
+
+	global := SchedulerLocation()
+	MainScheduler.ChangeLocation(global)
+
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	wanted := make(map[uint]bool, len(tasks))
+	for _, t := range tasks {
+		wanted[t.ID] = true
+		scheduleLocked(t, global)
+	}
+	for id := range scheduledSpecs {
+		if !wanted[id] {
+			unscheduleLocked(id)
 		}
 	}
+	log.Info().Int("count", len(scheduledSpecs)).Msg("调度器中的定时任务已同步")
 }
 
-func RunManualTask(task models.Task) bool {
+// 任务运行被取消的原因
+var (
+	errTaskChanged  = errors.New("任务配置已变更")        // 停止本次运行，已处理的结果照常保存
+	errRunDiscarded = errors.New("任务源目录已变更或任务已删除") // 停止本次运行，不再写入文件记录和断点
+)
+
+// cancelRunLocked 以指定原因取消任务的运行 (需持有 taskMutex)
+func cancelRunLocked(taskID uint, cause error) {
+	if cancel, running := runningTasks[taskID]; running {
+		log.Info().Uint("taskID", taskID).Str("原因", cause.Error()).Msg("停止本次运行")
+		cancel(cause)
+	}
+}
+
+// DiscardTaskRun 任务源目录变更或任务删除前调用：停止正在运行的扫描且丢弃其结果，
+// 避免旧配置的文件记录和断点在清理之后重新写入
+func DiscardTaskRun(taskID uint) {
 	taskMutex.Lock()
 	defer taskMutex.Unlock()
-	if _, exists := runningTasks[task.ID]; exists {
-		return false
+	cancelRunLocked(taskID, errRunDiscarded)
+}
+
+// RefreshTask 任务新增、修改或删除后调用：只替换该任务的定时任务；
+// 该任务正在运行时停止本次运行，排队中时同步最新配置，其他任务不受影响
+func RefreshTask(taskID uint) {
+	var task models.Task
+	exists := database.DB.First(&task, taskID).Error == nil
+
+	taskMutex.Lock()
+	cancelRunLocked(taskID, errTaskChanged)
+	if exists {
+		syncQueuedTaskLocked(taskID, &task)
+	} else {
+		syncQueuedTaskLocked(taskID, nil)
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	runningTasks[task.ID] = cancel
-	go RunScanTask(ctx, task)
-	return true
+	dispatchLocked()
+	taskMutex.Unlock()
+
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	if !exists || !task.Enabled {
+		unscheduleLocked(taskID)
+		return
+	}
+	scheduleLocked(task, SchedulerLocation())
+}
+
+func jobTag(taskID uint) string {
+	return "task-" + strconv.FormatUint(uint64(taskID), 10)
 }
 
+// scheduleLocked 注册任务的定时任务，表达式未变化时保持原有任务不动 (需持有 scheduleMutex)
+func scheduleLocked(task models.Task, global *time.Location) {
+	spec := taskCronSpec(task, global)
+	if current, ok := scheduledSpecs[task.ID]; ok && current == spec {
+		return
+	}
+	unscheduleLocked(task.ID)
+	taskID := task.ID
+	if _, err := MainScheduler.Cron(spec).Tag(jobTag(taskID)).Do(runScheduledTask, taskID); err != nil {
+		log.Error().Err(err).Str("task", task.Name).Msg("添加任务到调度器失败")
+		return
+	}
+	scheduledSpecs[taskID] = spec
+}
+
+// unscheduleLocked 从调度器中移除任务的定时任务 (需持有 scheduleMutex)
+func unscheduleLocked(taskID uint) {
+	if _, ok := scheduledSpecs[taskID]; !ok {
+		return
+	}
+	MainScheduler.RemoveByTag(jobTag(taskID))
+	delete(scheduledSpecs, taskID)
+}
+
+// runScheduledTask 定时触发时读取最新的任务配置再加入队列
+func runScheduledTask(taskID uint) {
+	var task models.Task
+	if err := database.DB.First(&task, taskID).Error; err != nil || !task.Enabled {
+		return
+	}
+	if !EnqueueTask(task, nil, RunSourceCron) {
+		log.Warn().Str("task", task.Name).Msg("任务已在运行或排队，跳过此次定时执行")
+	}
+}
+
+// RunManualTask 手动执行任务，优先于定时任务排队；任务已在运行或排队时返回 false
+func RunManualTask(task models.Task) bool {
+	return EnqueueTask(task, nil, RunSourceManual)
+}
+
+// StopTask 停止正在运行的任务，或将排队中的任务移出队列
 func StopTask(taskID uint) {
 	taskMutex.Lock()
-	defer taskMutex.Unlock()
-	if cancel, exists := runningTasks[taskID]; exists {
-		cancel()
+	cancel, exists := runningTasks[taskID]
+	if exists {
+		cancel(nil)
+	}
+	taskMutex.Unlock()
+	if !exists {
+		CancelQueuedTask(taskID)
 	}
 }
 
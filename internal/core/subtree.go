@@ -0,0 +1,247 @@
+package core
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"cloudstream/internal/pan123"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// pathNode 云盘路径上的一级目录，ID 对 123 云盘为文件 ID，对 OpenList 为完整路径
+type pathNode struct {
+	ID   string
+	Name string
+}
+
+// SubtreeTarget 需要扫描的任务及其子目录范围
+type SubtreeTarget struct {
+	Task  models.Task
+	Scope *ScanScope
+}
+
+// resolveCloudChain 解析从根目录到目标目录的路径链；目标为文件时取其所在目录
+func resolveCloudChain(client *pan123.Client, account models.Account, folderID, cloudPath string) ([]pathNode, error) {
+	if account.Type == models.AccountTypeOpenList {
+		target := folderID
+		if target == "" {
+			target = cloudPath
+		}
+		target = path.Clean("/" + strings.TrimSpace(target))
+		if target != "/" {
+			// 在父目录中确认目标类型；列表失败 (网络、鉴权等) 直接返回错误，避免误判为文件而扩大扫描范围
+			files, err := client.ListOpenListDirectory(path.Dir(target))
+			if err != nil {
+				return nil, err
+			}
+			var found *pan123.FileInfo
+			for i := range files {
+				if files[i].FileName == path.Base(target) {
+					found = &files[i]
+					break
+				}
+			}
+			if found == nil {
+				return nil, fmt.Errorf("云盘路径不存在: %s", target)
+			}
+			if !found.IsDir() {
+				target = path.Dir(target)
+			}
+		}
+		chain := []pathNode{{ID: "/"}}
+		current := "/"
+		for _, name := range splitCloudPath(target) {
+			current = joinOpenListPath(current, name)
+			chain = append(chain, pathNode{ID: current, Name: name})
+		}
+		return chain, nil
+	}
+
+	if folderID != "" {
+		id, err := strconv.ParseInt(folderID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的目录ID: %s", folderID)
+		}
+		var reversed []pathNode
+		for id != 0 {
+			info, err := client.GetFileDetail(id)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() || len(reversed) > 0 {
+				reversed = append(reversed, pathNode{ID: strconv.FormatInt(info.FileId, 10), Name: info.FileName})
+			}
+			id = info.ParentFileId
+		}
+		chain := []pathNode{{ID: "0"}}
+		for i := len(reversed) - 1; i >= 0; i-- {
+			chain = append(chain, reversed[i])
+		}
+		return chain, nil
+	}
+
+	chain := []pathNode{{ID: "0"}}
+	var parentID int64
+	for _, name := range splitCloudPath(cloudPath) {
+		info, err := client.FindChild(parentID, name)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			return nil, fmt.Errorf("云盘路径不存在: %s", cloudPath)
+		}
+		if !info.IsDir() {
+			break
+		}
+		parentID = info.FileId
+		chain = append(chain, pathNode{ID: strconv.FormatInt(info.FileId, 10), Name: info.FileName})
+	}
+	return chain, nil
+}
+
+func splitCloudPath(p string) []string {
+	var parts []string
+	for _, part := range strings.Split(strings.ReplaceAll(p, "\\", "/"), "/") {
+		if part = strings.TrimSpace(part); part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// normalizeSourceFolder 统一根目录的写法，便于与路径链比较
+func normalizeSourceFolder(accountType, id string) string {
+	id = strings.TrimSpace(id)
+	if accountType == models.AccountTypeOpenList {
+		if id == "" || id == "0" {
+			return "/"
+		}
+		return path.Clean("/" + id)
+	}
+	if id == "" {
+		return "0"
+	}
+	return id
+}
+
+// scopeForTask 目标目录位于任务源目录之下时返回对应的扫描范围
+func scopeForTask(task models.Task, accountType string, chain []pathNode) (*ScanScope, bool) {
+	source := normalizeSourceFolder(accountType, task.SourceFolderID)
+	for i, node := range chain {
+		if node.ID != source {
+			continue
+		}
+		var names []string
+		for _, n := range chain[i+1:] {
+			names = append(names, n.Name)
+		}
+		return &ScanScope{
+			FolderID:   chain[len(chain)-1].ID,
+			RelPath:    path.Join(names...),
+			SyncDelete: true,
+		}, true
+	}
+	return nil, false
+}
+
+// FindSubtreeTargets 根据云盘路径或目录 ID 找出包含该目录的已启用任务；accountID 为 0 时检查所有账户
+func FindSubtreeTargets(accountID uint, folderID, cloudPath string) ([]SubtreeTarget, error) {
+	query := database.DB.Where("enabled = ?", true)
+	if accountID != 0 {
+		query = query.Where("account_id = ?", accountID)
+	}
+	var tasks []models.Task
+	if err := query.Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	byAccount := make(map[uint][]models.Task)
+	for _, task := range tasks {
+		byAccount[task.AccountID] = append(byAccount[task.AccountID], task)
+	}
+
+	var targets []SubtreeTarget
+	var lastErr error
+	for id, accountTasks := range byAccount {
+		var account models.Account
+		if err := database.DB.First(&account, id).Error; err != nil {
+			continue
+		}
+		chain, err := resolveCloudChain(pan123.NewClient(account), account, folderID, cloudPath)
+		if err != nil {
+			lastErr = fmt.Errorf("账户 %s: %w", account.Name, err)
+			continue
+		}
+		for _, task := range accountTasks {
+			if scope, ok := scopeForTask(task, account.Type, chain); ok {
+				targets = append(targets, SubtreeTarget{Task: task, Scope: scope})
+			}
+		}
+	}
+	if len(targets) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return targets, nil
+}
+
+// RunSubtreeScan 将任务的子目录扫描加入执行队列，任务已在运行或排队时返回 false
+func RunSubtreeScan(task models.Task, scope *ScanScope, source string) bool {
+	return EnqueueTask(task, scope, source)
+}
+
+// ResolveTaskScope 将任务源目录下的子目录 (相对路径或云盘目录 ID) 解析为扫描范围
+func ResolveTaskScope(task models.Task, folderID, relPath string, syncDelete bool) (*ScanScope, error) {
+	var account models.Account
+	if err := database.DB.First(&account, task.AccountID).Error; err != nil {
+		return nil, fmt.Errorf("找不到关联的云账户")
+	}
+	client := pan123.NewClient(account)
+	source := normalizeSourceFolder(account.Type, task.SourceFolderID)
+
+	if folderID != "" {
+		chain, err := resolveCloudChain(client, account, folderID, "")
+		if err != nil {
+			return nil, err
+		}
+		scope, ok := scopeForTask(task, account.Type, chain)
+		if !ok {
+			return nil, fmt.Errorf("目录不在任务的源目录下")
+		}
+		scope.SyncDelete = syncDelete
+		return scope, nil
+	}
+
+	names := splitCloudPath(relPath)
+	for _, name := range names {
+		if name == ".." {
+			return nil, fmt.Errorf("子目录路径不能包含 ..")
+		}
+	}
+	scope := &ScanScope{FolderID: source, RelPath: path.Join(names...), SyncDelete: syncDelete}
+	if account.Type == models.AccountTypeOpenList {
+		scope.FolderID = joinOpenListPath(append([]string{source}, names...)...)
+		if _, err := client.ListOpenListDirectory(scope.FolderID); err != nil {
+			return nil, fmt.Errorf("子目录不存在: %w", err)
+		}
+		return scope, nil
+	}
+
+	parentID, err := strconv.ParseInt(source, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("无效的目录ID: %s", source)
+	}
+	for _, name := range names {
+		info, err := client.FindChild(parentID, name)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil || !info.IsDir() {
+			return nil, fmt.Errorf("子目录不存在: %s", scope.RelPath)
+		}
+		parentID = info.FileId
+	}
+	scope.FolderID = strconv.FormatInt(parentID, 10)
+	return scope, nil
+}
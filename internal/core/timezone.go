@@ -0,0 +1,84 @@
+package core
+
+import (
+	"cloudstream/internal/database"
+	"cloudstream/internal/models"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"time"
+)
+
+// MaxNextRuns 任务列表中最多返回的下次执行时间个数
+const MaxNextRuns = 20
+
+// ValidateTimezone 校验 IANA 时区名称 (如 Asia/Shanghai)，空字符串表示沿用上级设置
+func ValidateTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("无效的时区: %s", name)
+	}
+	return nil
+}
+
+// SchedulerLocation 全局调度时区，未设置或无效时使用服务器本地时区 (遵循 TZ 环境变量)
+func SchedulerLocation() *time.Location {
+	name := database.GetSystemSetting().Timezone
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Warn().Str("timezone", name).Msg("全局时区无效，使用服务器本地时区")
+		return time.Local
+	}
+	return loc
+}
+
+// TaskLocation 任务的调度时区：任务单独设置时优先，否则使用全局时区
+func TaskLocation(task models.Task, global *time.Location) *time.Location {
+	if task.Timezone != "" {
+		if loc, err := time.LoadLocation(task.Timezone); err == nil {
+			return loc
+		}
+		log.Warn().Str("task", task.Name).Str("timezone", task.Timezone).Msg("任务时区无效，使用全局时区")
+	}
+	return global
+}
+
+// taskCronSpec 为任务的 Cron 表达式加上时区前缀；表达式已自带 CRON_TZ/TZ 时保持不变
+func taskCronSpec(task models.Task, global *time.Location) string {
+	spec := strings.TrimSpace(task.Cron)
+	if strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=") {
+		return spec
+	}
+	return "CRON_TZ=" + TaskLocation(task, global).String() + " " + spec
+}
+
+// NextRunTimes 按任务时区计算之后 n 次的执行时间，返回值带有该时区的偏移
+func NextRunTimes(task models.Task, global *time.Location, n int) []time.Time {
+	if n <= 0 {
+		return nil
+	}
+	if n > MaxNextRuns {
+		n = MaxNextRuns
+	}
+	schedule, err := cron.ParseStandard(taskCronSpec(task, global))
+	if err != nil {
+		return nil
+	}
+	loc := TaskLocation(task, global)
+	runs := make([]time.Time, 0, n)
+	next := time.Now().In(loc)
+	for i := 0; i < n; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		runs = append(runs, next)
+	}
+	return runs
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"cloudstream/internal/models"
 	"cloudstream/internal/utils"
+	"encoding/json"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"gorm.io/driver/sqlite"
@@ -46,12 +47,31 @@ func ConnectDatabase(dbPath string) error {
 		log.Warn().Err(err).Msg("设置 busy_timeout 失败")
 	}
 
+	// 断点改为按 (任务, 子目录) 唯一，删除旧的单列唯一索引
+	if DB.Migrator().HasIndex(&models.TaskCheckpoint{}, "idx_task_checkpoints_task_id") {
+		if err := DB.Migrator().DropIndex(&models.TaskCheckpoint{}, "idx_task_checkpoints_task_id"); err != nil {
+			return fmt.Errorf("删除旧的断点索引失败: %w", err)
+		}
+	}
+
 	// 自动迁移结构
 	err = DB.AutoMigrate(
 		&models.User{},
 		&models.Task{},
 		&models.Account{},
 		&models.TaskFile{},
+		&models.TaskCheckpoint{},
+		&models.TaskDependency{},
+		&models.UserIdentity{},
+		&models.SystemSetting{},
+		&models.LoginLockout{},
+		&models.Session{},
+		&models.AuditLog{},
+		&models.NotificationChannel{},
+		&models.NotificationTemplate{},
+		&models.NotificationDigestItem{},
+		&models.NotificationDelivery{},
+		&models.MediaServer{},
 	)
 	if err != nil {
 		return fmt.Errorf("数据库迁移失败: %w", err)
@@ -69,12 +89,75 @@ func ConnectDatabase(dbPath string) error {
 			Username:     "admin",
 			PasswordHash: hashedPassword,
 			TokenVersion: 1,
+			Role:         models.RoleAdmin,
 		}
 		if err := DB.Create(&defaultUser).Error; err != nil {
 			return fmt.Errorf("创建默认管理员失败: %w", err)
 		}
 	}
 
+	if err := migrateLegacyNotification(); err != nil {
+		log.Warn().Err(err).Msg("迁移旧版通知设置失败")
+	}
+
 	log.Info().Msg("数据库连接和迁移成功 (WAL模式已启用)")
 	return nil
-}
\ No newline at end of file
+}
+
+// Close 关闭数据库连接，停机时调用
+func Close() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// GetSystemSetting 读取全局设置，不存在时以默认值创建
+func GetSystemSetting() models.SystemSetting {
+	var setting models.SystemSetting
+	if err := DB.FirstOrCreate(&setting, models.SystemSetting{ID: 1}).Error; err != nil {
+		log.Error().Err(err).Msg("读取系统设置失败")
+	}
+	return setting
+}
+
+// migrateLegacyNotification 将旧版保存在用户上的单一通知配置迁移为通知渠道 (仅在没有任何渠道时执行)
+func migrateLegacyNotification() error {
+	var channelCount int64
+	if err := DB.Model(&models.NotificationChannel{}).Count(&channelCount).Error; err != nil || channelCount > 0 {
+		return err
+	}
+	var user models.User
+	if err := DB.First(&user).Error; err != nil {
+		return nil
+	}
+	channel, ok := LegacyNotificationChannel(user)
+	if !ok {
+		return nil
+	}
+	log.Info().Str("type", channel.Type).Msg("已将旧版通知设置迁移为通知渠道")
+	return DB.Create(&channel).Error
+}
+
+// LegacyNotificationChannel 根据用户上的旧版通知字段生成对应的渠道
+func LegacyNotificationChannel(user models.User) (models.NotificationChannel, bool) {
+	channel := models.NotificationChannel{Name: models.LegacyChannelName, Enabled: true}
+	var settings map[string]string
+	if user.NotifyType == models.NotifyTypeTelegram {
+		if user.TelegramToken == "" || user.TelegramChatID == "" {
+			return channel, false
+		}
+		channel.Type = models.NotifyTypeTelegram
+		settings = map[string]string{"token": user.TelegramToken, "chatId": user.TelegramChatID}
+	} else {
+		if user.WebhookURL == "" {
+			return channel, false
+		}
+		channel.Type = models.NotifyTypeWebhook
+		settings = map[string]string{"url": user.WebhookURL}
+	}
+	data, _ := json.Marshal(settings)
+	channel.Settings = string(data)
+	return channel, true
+}
@@ -0,0 +1,71 @@
+package mediaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// EmbyServer Emby 与 Jellyfin 共用同一套媒体库接口，仅认证头不同
+type EmbyServer struct {
+	cfg      Config
+	jellyfin bool
+}
+
+func init() {
+	Register("emby", func(cfg Config) (Server, error) {
+		return &EmbyServer{cfg: cfg}, nil
+	})
+	Register("jellyfin", func(cfg Config) (Server, error) {
+		return &EmbyServer{cfg: cfg, jellyfin: true}, nil
+	})
+}
+
+func (s *EmbyServer) request(method, path string, payload interface{}) ([]byte, error) {
+	var body []byte
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	req, err := http.NewRequest(method, s.cfg.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.jellyfin {
+		req.Header.Set("Authorization", fmt.Sprintf(`MediaBrowser Token="%s"`, s.cfg.APIKey))
+	} else {
+		req.Header.Set("X-Emby-Token", s.cfg.APIKey)
+	}
+	return doRequest(req)
+}
+
+func (s *EmbyServer) Test() error {
+	_, err := s.request(http.MethodGet, "/System/Info", nil)
+	return err
+}
+
+func (s *EmbyServer) RefreshLibrary() error {
+	_, err := s.request(http.MethodPost, "/Library/Refresh", nil)
+	return err
+}
+
+// RefreshPaths 通过 /Library/Media/Updated 通知服务器指定目录有变化，由服务器只扫描这些目录
+func (s *EmbyServer) RefreshPaths(paths []string) error {
+	type update struct {
+		Path       string `json:"Path"`
+		UpdateType string `json:"UpdateType"`
+	}
+	updates := make([]update, len(paths))
+	for i, p := range paths {
+		updates[i] = update{Path: p, UpdateType: "Modified"}
+	}
+	_, err := s.request(http.MethodPost, "/Library/Media/Updated", map[string]interface{}{"Updates": updates})
+	return err
+}
@@ -0,0 +1,75 @@
+package mediaserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Server 媒体服务器的统一接口
+type Server interface {
+	// Test 校验地址与 API Key 是否可用
+	Test() error
+	// RefreshLibrary 刷新全部媒体库
+	RefreshLibrary() error
+	// RefreshPaths 只刷新指定目录 (媒体服务器视角的路径)
+	RefreshPaths(paths []string) error
+}
+
+// Config 媒体服务器连接配置
+type Config struct {
+	URL    string
+	APIKey string
+}
+
+// Factory 根据配置创建 Server
+type Factory func(cfg Config) (Server, error)
+
+var factories = make(map[string]Factory)
+
+// Register 注册一种媒体服务器类型，在各实现文件的 init 中调用
+func Register(serverType string, factory Factory) {
+	factories[serverType] = factory
+}
+
+// New 按类型和配置创建 Server
+func New(serverType string, cfg Config) (Server, error) {
+	factory, ok := factories[serverType]
+	if !ok {
+		return nil, fmt.Errorf("不支持的媒体服务器类型: %s", serverType)
+	}
+	cfg.URL = strings.TrimRight(strings.TrimSpace(cfg.URL), "/")
+	if cfg.URL == "" || cfg.APIKey == "" {
+		return nil, fmt.Errorf("媒体服务器地址和 API Key 不能为空")
+	}
+	return factory(cfg)
+}
+
+// Types 返回所有已注册的媒体服务器类型
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// doRequest 发送请求，非 2xx 响应视为失败
+func doRequest(req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
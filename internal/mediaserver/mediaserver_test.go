@@ -0,0 +1,231 @@
+package mediaserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedRequest 模拟服务器收到的请求
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   string
+}
+
+// mockServer 按路径返回预设响应，并记录所有请求
+type mockServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+func newMockServer(t *testing.T, responses map[string]string) *mockServer {
+	t.Helper()
+	m := &mockServer{}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		m.mu.Lock()
+		m.requests = append(m.requests, recordedRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Header: r.Header.Clone(),
+			Body:   string(body),
+		})
+		m.mu.Unlock()
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, resp)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockServer) recorded() []recordedRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]recordedRequest(nil), m.requests...)
+}
+
+func TestEmbyRefresh(t *testing.T) {
+	mock := newMockServer(t, map[string]string{"/Library/Refresh": "", "/Library/Media/Updated": ""})
+	server, err := New("emby", Config{URL: mock.URL + "/", APIKey: "emby-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.RefreshLibrary(); err != nil {
+		t.Fatalf("刷新全部媒体库失败: %v", err)
+	}
+	if err := server.RefreshPaths([]string{"/mnt/media/TV/Show", "/mnt/media/Movies/A (2020)"}); err != nil {
+		t.Fatalf("刷新目录失败: %v", err)
+	}
+
+	reqs := mock.recorded()
+	if len(reqs) != 2 {
+		t.Fatalf("收到 %d 个请求", len(reqs))
+	}
+	if reqs[0].Method != http.MethodPost || reqs[0].Path != "/Library/Refresh" || reqs[0].Header.Get("X-Emby-Token") != "emby-key" {
+		t.Errorf("全部刷新请求错误: %+v", reqs[0])
+	}
+
+	update := reqs[1]
+	if update.Method != http.MethodPost || update.Path != "/Library/Media/Updated" || update.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("目录刷新请求错误: %+v", update)
+	}
+	var payload struct {
+		Updates []struct {
+			Path       string `json:"Path"`
+			UpdateType string `json:"UpdateType"`
+		} `json:"Updates"`
+	}
+	if err := json.Unmarshal([]byte(update.Body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Updates) != 2 || payload.Updates[0].Path != "/mnt/media/TV/Show" || payload.Updates[1].UpdateType != "Modified" {
+		t.Errorf("目录刷新请求体错误: %s", update.Body)
+	}
+}
+
+func TestJellyfinAuthHeader(t *testing.T) {
+	mock := newMockServer(t, map[string]string{"/System/Info": `{"Version":"10.9.0"}`})
+	server, err := New("jellyfin", Config{URL: mock.URL, APIKey: "jf-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Test(); err != nil {
+		t.Fatal(err)
+	}
+	req := mock.recorded()[0]
+	if req.Header.Get("Authorization") != `MediaBrowser Token="jf-key"` || req.Header.Get("X-Emby-Token") != "" {
+		t.Errorf("Jellyfin 认证头错误: %v", req.Header)
+	}
+}
+
+func TestEmbyRefreshError(t *testing.T) {
+	mock := newMockServer(t, nil)
+	server, err := New("emby", Config{URL: mock.URL, APIKey: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RefreshLibrary(); err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("非 2xx 响应应返回错误，实际: %v", err)
+	}
+}
+
+const plexSections = `{"MediaContainer":{"Directory":[
+	{"key":"1","title":"Movies","Location":[{"path":"/mnt/media/Movies"}]},
+	{"key":"2","title":"TV","Location":[{"path":"/mnt/media/TV/"},{"path":"/mnt/other/TV"}]}
+]}}`
+
+func newPlexMock(t *testing.T) *mockServer {
+	return newMockServer(t, map[string]string{
+		"/library/sections":           plexSections,
+		"/library/sections/1/refresh": "",
+		"/library/sections/2/refresh": "",
+	})
+}
+
+func TestPlexRefreshLibrary(t *testing.T) {
+	mock := newPlexMock(t)
+	server, err := New("plex", Config{URL: mock.URL, APIKey: "plex-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RefreshLibrary(); err != nil {
+		t.Fatalf("刷新全部媒体库失败: %v", err)
+	}
+
+	reqs := mock.recorded()
+	var paths []string
+	for _, r := range reqs {
+		if r.Method != http.MethodGet || r.Header.Get("X-Plex-Token") != "plex-token" || r.Header.Get("Accept") != "application/json" {
+			t.Errorf("请求方法或请求头错误: %+v", r)
+		}
+		paths = append(paths, r.Path)
+	}
+	want := []string{"/library/sections", "/library/sections/1/refresh", "/library/sections/2/refresh"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("请求顺序错误: %v", paths)
+	}
+}
+
+func TestPlexRefreshPaths(t *testing.T) {
+	mock := newPlexMock(t)
+	server, err := New("plex", Config{URL: mock.URL, APIKey: "plex-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RefreshPaths([]string{"/mnt/media/TV/Show A/Season 1", "/mnt/media/Movies"}); err != nil {
+		t.Fatalf("刷新目录失败: %v", err)
+	}
+
+	var refreshes []string
+	for _, r := range mock.recorded() {
+		if strings.HasSuffix(r.Path, "/refresh") {
+			refreshes = append(refreshes, r.Path+"?"+r.Query)
+		}
+	}
+	want := []string{
+		"/library/sections/2/refresh?path=%2Fmnt%2Fmedia%2FTV%2FShow+A%2FSeason+1",
+		"/library/sections/1/refresh?path=%2Fmnt%2Fmedia%2FMovies",
+	}
+	if strings.Join(refreshes, ",") != strings.Join(want, ",") {
+		t.Errorf("局部刷新请求错误: %v", refreshes)
+	}
+}
+
+func TestPlexRefreshPathOutsideLibraries(t *testing.T) {
+	mock := newPlexMock(t)
+	server, err := New("plex", Config{URL: mock.URL, APIKey: "plex-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 前缀相同但不在媒体库目录内
+	err = server.RefreshPaths([]string{"/mnt/media/Movies2/X"})
+	if err == nil || !strings.Contains(err.Error(), "没有媒体库包含路径") {
+		t.Errorf("应拒绝不属于任何媒体库的路径，实际: %v", err)
+	}
+	for _, r := range mock.recorded() {
+		if strings.HasSuffix(r.Path, "/refresh") {
+			t.Errorf("不应发送刷新请求: %s", r.Path)
+		}
+	}
+}
+
+func TestPlexRefreshWindowsPaths(t *testing.T) {
+	mock := newMockServer(t, map[string]string{
+		"/library/sections":           `{"MediaContainer":{"Directory":[{"key":"3","title":"TV","Location":[{"path":"D:\\Media\\TV\\"}]}]}}`,
+		"/library/sections/3/refresh": "",
+	})
+	server, err := New("plex", Config{URL: mock.URL, APIKey: "plex-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 无法匹配的路径不影响后面的路径
+	err = server.RefreshPaths([]string{`E:\Other\X`, `d:\media\TV\Show A`})
+	if err == nil || !strings.Contains(err.Error(), `E:\Other\X`) {
+		t.Errorf("应返回无法匹配的路径错误，实际: %v", err)
+	}
+
+	var refreshes []string
+	for _, r := range mock.recorded() {
+		if strings.HasSuffix(r.Path, "/refresh") {
+			refreshes = append(refreshes, r.Path+"?"+r.Query)
+		}
+	}
+	if len(refreshes) != 1 || refreshes[0] != "/library/sections/3/refresh?path=d%3A%5Cmedia%5CTV%5CShow+A" {
+		t.Errorf("Windows 路径刷新请求错误: %v", refreshes)
+	}
+}
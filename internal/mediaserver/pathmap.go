@@ -0,0 +1,67 @@
+package mediaserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathMapping 将 CloudStream 本地路径前缀映射为媒体服务器看到的路径前缀
+type PathMapping struct {
+	From string `json:"from"` // CloudStream 中的路径，例如 /data/strm
+	To   string `json:"to"`   // 媒体服务器中的路径，例如 /mnt/media/strm 或 D:\Media\strm
+}
+
+// ParsePathMappings 解析并校验映射规则 JSON，空字符串表示两边路径一致
+func ParsePathMappings(raw string) ([]PathMapping, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var mappings []PathMapping
+	if err := json.Unmarshal([]byte(raw), &mappings); err != nil {
+		return nil, fmt.Errorf("路径映射格式错误: %w", err)
+	}
+	for i := range mappings {
+		from := strings.TrimSpace(mappings[i].From)
+		to := strings.TrimSpace(mappings[i].To)
+		if !strings.HasPrefix(from, "/") || to == "" {
+			return nil, fmt.Errorf("第 %d 条路径映射无效：本地路径必须是绝对路径，目标路径不能为空", i+1)
+		}
+		mappings[i].From = path.Clean(from)
+		mappings[i].To = to
+	}
+	return mappings, nil
+}
+
+// TranslatePath 按最长前缀匹配转换路径；没有任何映射规则时原样返回
+func TranslatePath(mappings []PathMapping, localPath string) (string, bool) {
+	if len(mappings) == 0 {
+		return localPath, true
+	}
+	localPath = path.Clean(localPath)
+	var best *PathMapping
+	for i := range mappings {
+		m := &mappings[i]
+		if (localPath == m.From || m.From == "/" || strings.HasPrefix(localPath, m.From+"/")) &&
+			(best == nil || len(m.From) > len(best.From)) {
+			best = m
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+
+	rest := strings.TrimPrefix(strings.TrimPrefix(localPath, best.From), "/")
+	to := best.To
+	sep := "/"
+	if strings.Contains(to, `\`) {
+		// Windows 上的媒体服务器
+		sep = `\`
+		rest = strings.ReplaceAll(rest, "/", `\`)
+	}
+	if rest == "" {
+		return to, true
+	}
+	return strings.TrimRight(to, sep) + sep + rest, true
+}
@@ -0,0 +1,120 @@
+package mediaserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PlexServer Plex Media Server，API Key 即 X-Plex-Token
+type PlexServer struct {
+	cfg Config
+}
+
+type plexSection struct {
+	Key      string `json:"key"`
+	Title    string `json:"title"`
+	Location []struct {
+		Path string `json:"path"`
+	} `json:"Location"`
+}
+
+func init() {
+	Register("plex", func(cfg Config) (Server, error) {
+		return &PlexServer{cfg: cfg}, nil
+	})
+}
+
+func (s *PlexServer) get(path string, query url.Values) ([]byte, error) {
+	target := s.cfg.URL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("X-Plex-Token", s.cfg.APIKey)
+	req.Header.Set("Accept", "application/json")
+	return doRequest(req)
+}
+
+func (s *PlexServer) sections() ([]plexSection, error) {
+	body, err := s.get("/library/sections", nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		MediaContainer struct {
+			Directory []plexSection `json:"Directory"`
+		} `json:"MediaContainer"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析媒体库列表失败: %w", err)
+	}
+	return resp.MediaContainer.Directory, nil
+}
+
+func (s *PlexServer) Test() error {
+	_, err := s.get("/identity", nil)
+	return err
+}
+
+func (s *PlexServer) RefreshLibrary() error {
+	sections, err := s.sections()
+	if err != nil {
+		return err
+	}
+	for _, section := range sections {
+		if _, err := s.get("/library/sections/"+section.Key+"/refresh", nil); err != nil {
+			return fmt.Errorf("刷新媒体库 %s 失败: %w", section.Title, err)
+		}
+	}
+	return nil
+}
+
+// RefreshPaths 找到包含该路径的媒体库，使用 path 参数做局部扫描；单个路径失败不影响其余路径
+func (s *PlexServer) RefreshPaths(paths []string) error {
+	sections, err := s.sections()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range paths {
+		section := matchPlexSection(sections, p)
+		if section == nil {
+			errs = append(errs, fmt.Errorf("没有媒体库包含路径 %s", p))
+			continue
+		}
+		if _, err := s.get("/library/sections/"+section.Key+"/refresh", url.Values{"path": {p}}); err != nil {
+			errs = append(errs, fmt.Errorf("刷新路径 %s 失败: %w", p, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// normalizePlexPath 统一路径分隔符并去掉末尾分隔符；Windows 路径 (盘符或反斜杠) 不区分大小写
+func normalizePlexPath(p string) string {
+	windows := strings.Contains(p, `\`) || (len(p) >= 2 && p[1] == ':')
+	p = strings.TrimRight(strings.ReplaceAll(p, `\`, "/"), "/")
+	if windows {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+func matchPlexSection(sections []plexSection, p string) *plexSection {
+	target := normalizePlexPath(p)
+	for i := range sections {
+		for _, loc := range sections[i].Location {
+			root := normalizePlexPath(loc.Path)
+			if target == root || strings.HasPrefix(target, root+"/") {
+				return &sections[i]
+			}
+		}
+	}
+	return nil
+}
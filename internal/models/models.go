@@ -2,6 +2,7 @@ package models
 
 import (
 	"gorm.io/gorm"
+	"time"
 )
 
 const (
@@ -10,6 +11,14 @@ const (
 
 	NotifyTypeWebhook  = "webhook"
 	NotifyTypeTelegram = "telegram"
+
+	// 旧版“通知设置”页面对应的渠道名称
+	LegacyChannelName = "默认通知"
+
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+
+	IdentityProviderHeader = "header"
 )
 
 type User struct {
@@ -17,11 +26,18 @@ type User struct {
 	Username     string `gorm:"unique;not null"`
 	PasswordHash string `gorm:"not null"`
 	TokenVersion int    `gorm:"default:1"`
+	Role         string `gorm:"default:'admin'" json:"Role"`
 
 	NotifyType     string `gorm:"default:'webhook'" json:"NotifyType"`
 	WebhookURL     string `json:"WebhookURL"`
 	TelegramToken  string `json:"TelegramToken"`
 	TelegramChatID string `json:"TelegramChatID"`
+
+	// 两步验证 (TOTP)，密钥使用 JWT 密钥派生的 AES 密钥加密存储
+	TOTPEnabled       bool   `gorm:"default:false" json:"TOTPEnabled"`
+	TOTPSecret        string `json:"-"`
+	TOTPRecoveryCodes string `json:"-"` // 恢复码的 SHA-256 摘要，JSON 数组
+	TOTPLastStep      int64  `json:"-"` // 最近一次成功使用的动态码时间步，同一个码不能重复使用
 }
 
 type Account struct {
@@ -33,6 +49,12 @@ type Account struct {
 	OpenListURL   string `json:"OpenListURL"`
 	OpenListToken string `json:"OpenListToken"`
 	StrmBaseURL   string `json:"StrmBaseURL"`
+
+	// 接口限流 (令牌桶)，同一账户的扫描、文件浏览和播放共享额度；0 表示使用默认值
+	ListQPS       float64 `gorm:"column:list_qps" json:"ListQPS"`
+	ListBurst     int     `json:"ListBurst"`
+	DownloadQPS   float64 `gorm:"column:download_qps" json:"DownloadQPS"`
+	DownloadBurst int     `json:"DownloadBurst"`
 }
 
 type Task struct {
@@ -49,14 +71,223 @@ type Task struct {
 	StrmExtensions string `gorm:"default:'mp4,mkv,ts,iso'" json:"StrmExtensions"`
 	MetaExtensions string `gorm:"default:'jpg,jpeg,png,webp,srt,ass,sub'" json:"MetaExtensions"`
 	Threads        int    `gorm:"default:4" json:"Threads"`
+	Timezone       string `json:"Timezone"` // Cron 表达式使用的时区，为空时使用全局时区
+
+	// 扫描完成后通知媒体服务器刷新
+	MediaServerID uint   `gorm:"default:0" json:"MediaServerID"`
+	RefreshMode   string `gorm:"default:''" json:"RefreshMode"` // 为空不刷新，full 刷新全部媒体库，path 只刷新有变化的目录
 
 	// 新增：进度追踪字段
 	ProcessedCount int    `gorm:"default:0" json:"ProcessedCount"` // 本次扫描已处理文件数
 	LastRunStatus  string `gorm:"default:''" json:"LastRunStatus"` // 例如: "运行中", "已完成", "错误"
 }
 
+// 媒体库刷新方式
+const (
+	RefreshModeFull = "full"
+	RefreshModePath = "path"
+)
+
+// MediaServer 媒体服务器集成 (Emby、Jellyfin、Plex)
+type MediaServer struct {
+	gorm.Model
+	Name    string `gorm:"unique;not null" json:"Name"`
+	Type    string `gorm:"not null" json:"Type"` // emby、jellyfin、plex
+	URL     string `gorm:"not null" json:"URL"`
+	APIKey  string `json:"APIKey"`
+	Enabled bool   `json:"Enabled"`
+
+	// 路径映射规则 JSON，例如 [{"from":"/data/strm","to":"/mnt/media/strm"}]，为空表示两边路径一致
+	PathMappings string `json:"PathMappings"`
+}
+
 type TaskFile struct {
 	ID       uint   `gorm:"primarykey"`
 	TaskID   uint   `gorm:"index;uniqueIndex:idx_task_file;not null"` 
 	FilePath string `gorm:"index;uniqueIndex:idx_task_file;not null"` 
-}
\ No newline at end of file
+}
+
+// 依赖任务的触发条件
+const (
+	DependencyOnSuccess = "success" // 上游任务成功完成后执行
+	DependencyOnFailure = "failure" // 上游任务失败后执行
+	DependencyAlways    = "always"  // 上游任务结束后总是执行 (手动停止除外)
+)
+
+// TaskDependency 任务依赖：上游任务结束且满足条件后自动执行下游任务
+type TaskDependency struct {
+	ID          uint      `gorm:"primarykey" json:"ID"`
+	TaskID      uint      `gorm:"uniqueIndex:idx_task_dependency;not null" json:"TaskID"`      // 下游任务
+	DependsOnID uint      `gorm:"uniqueIndex:idx_task_dependency;not null" json:"DependsOnID"` // 上游任务
+	Condition   string    `gorm:"default:'success'" json:"Condition"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+}
+
+// TaskCheckpoint 任务扫描断点，中断或部分失败后再次执行时跳过已完整扫描的目录
+type TaskCheckpoint struct {
+	ID            uint   `gorm:"primarykey"`
+	TaskID        uint   `gorm:"uniqueIndex:idx_task_checkpoint;not null"`
+	SubPath       string `gorm:"uniqueIndex:idx_task_checkpoint"` // 子目录扫描时的相对路径，完整扫描为空；每个范围各有一个断点
+	CompletedDirs string // 已完成目录的相对路径 (JSON 数组)
+	FailedDirs    string // 扫描失败目录的相对路径 (JSON 数组)
+	UpdatedAt     time.Time
+}
+
+// UserIdentity 外部身份 (OIDC subject / 反代头部用户名) 与本地用户的映射
+type UserIdentity struct {
+	ID        uint   `gorm:"primarykey"`
+	Provider  string `gorm:"uniqueIndex:idx_identity;not null"` // "oidc:<issuer>" 或 "header"
+	Subject   string `gorm:"uniqueIndex:idx_identity;not null"`
+	UserID    uint   `gorm:"index;not null"`
+	CreatedAt time.Time
+}
+
+// SystemSetting 全局系统设置，只有一行 (ID = 1)
+type SystemSetting struct {
+	ID uint `gorm:"primarykey" json:"-"`
+
+	// OIDC 单点登录 (授权码 + PKCE)
+	OIDCEnabled       bool   `gorm:"column:oidc_enabled;default:false" json:"OIDCEnabled"`
+	OIDCIssuer        string `gorm:"column:oidc_issuer" json:"OIDCIssuer"`
+	OIDCClientID      string `gorm:"column:oidc_client_id" json:"OIDCClientID"`
+	OIDCClientSecret  string `gorm:"column:oidc_client_secret" json:"OIDCClientSecret"`
+	OIDCRedirectURL   string `gorm:"column:oidc_redirect_url" json:"OIDCRedirectURL"`
+	OIDCScopes        string `gorm:"column:oidc_scopes;default:'openid profile email groups'" json:"OIDCScopes"`
+	OIDCUsernameClaim string `gorm:"column:oidc_username_claim;default:'preferred_username'" json:"OIDCUsernameClaim"`
+	OIDCGroupsClaim   string `gorm:"column:oidc_groups_claim;default:'groups'" json:"OIDCGroupsClaim"`
+
+	// 反向代理可信头部登录 (Authelia / Authentik 等)
+	TrustedHeaderEnabled bool   `gorm:"default:false" json:"TrustedHeaderEnabled"`
+	TrustedHeaderName    string `gorm:"default:'Remote-User'" json:"TrustedHeaderName"`
+	TrustedGroupsHeader  string `gorm:"default:'Remote-Groups'" json:"TrustedGroupsHeader"`
+	TrustedProxyIPs      string `json:"TrustedProxyIPs"` // 逗号分隔的 IP 或 CIDR
+
+	// 外部身份映射规则
+	SSOAutoCreate    bool   `gorm:"column:sso_auto_create;default:false" json:"SSOAutoCreate"`       // 未映射的外部用户自动创建本地用户
+	SSOMatchUsername bool   `gorm:"column:sso_match_username;default:false" json:"SSOMatchUsername"` // 允许按同名本地用户自动绑定
+	SSOAdminGroups   string `gorm:"column:sso_admin_groups" json:"SSOAdminGroups"`                   // 属于这些组的外部用户映射为管理员
+	SSODefaultRole   string `gorm:"column:sso_default_role;default:'viewer'" json:"SSODefaultRole"`
+
+	// 登录防爆破
+	LoginMaxFailures       int `gorm:"default:5" json:"LoginMaxFailures"`           // 连续失败多少次后开始锁定
+	LoginLockoutSeconds    int `gorm:"default:60" json:"LoginLockoutSeconds"`       // 首次锁定时长，之后每次翻倍
+	LoginLockoutMaxSeconds int `gorm:"default:86400" json:"LoginLockoutMaxSeconds"` // 锁定时长上限
+	LoginAlertThreshold    int `gorm:"default:10" json:"LoginAlertThreshold"`       // 失败次数达到该值时通知管理员，0 表示不通知
+
+	// 定时任务默认时区 (IANA 名称，如 Asia/Shanghai)，为空时使用服务器本地时区 (TZ 环境变量)
+	Timezone string `json:"Timezone"`
+
+	// 任务执行队列：全局并发上限与单个云账户的并发上限 (0 表示不限制)
+	MaxConcurrentTasks int `gorm:"default:2" json:"MaxConcurrentTasks"`
+	MaxTasksPerAccount int `gorm:"default:1" json:"MaxTasksPerAccount"`
+
+	// 云盘接口调用失败 (限流、授权失效、网络错误) 时的最大尝试次数，含首次
+	ProviderMaxAttempts int `gorm:"default:4" json:"ProviderMaxAttempts"`
+
+	// 外部触发扫描 (入站 Webhook)，为空时关闭该接口
+	InboundWebhookToken string `json:"InboundWebhookToken"`
+}
+
+// LoginLockout 登录失败计数与锁定状态，Key 形如 "ip:1.2.3.4" 或 "user:admin"
+type LoginLockout struct {
+	ID            uint   `gorm:"primarykey"`
+	Key           string `gorm:"uniqueIndex;not null"`
+	Failures      int
+	LockedUntil   time.Time
+	LastFailureAt time.Time
+}
+
+// Session 登录会话，服务端保存刷新令牌的摘要，可单独吊销
+type Session struct {
+	ID               uint       `gorm:"primarykey" json:"ID"`
+	CreatedAt        time.Time  `json:"CreatedAt"`
+	UserID           uint       `gorm:"index;not null" json:"-"`
+	TokenVersion     int        `json:"-"`
+	RefreshTokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	UserAgent        string     `json:"UserAgent"`
+	Device           string     `json:"Device"`
+	IP               string     `json:"IP"`
+	LastSeenAt       time.Time  `json:"LastSeenAt"`
+	ExpiresAt        time.Time  `json:"ExpiresAt"`
+	RevokedAt        *time.Time `json:"RevokedAt"`
+}
+
+// AuditLog 管理操作审计记录
+type AuditLog struct {
+	ID         uint      `gorm:"primarykey" json:"ID"`
+	CreatedAt  time.Time `gorm:"index" json:"CreatedAt"`
+	Actor      string    `gorm:"index" json:"Actor"`
+	Action     string    `gorm:"index" json:"Action"` // 例如 task.update、account.delete
+	TargetType string    `gorm:"index" json:"TargetType"`
+	TargetID   uint      `json:"TargetID"`
+	TargetName string    `json:"TargetName"`
+	Diff       string    `json:"Diff"` // 变更字段 JSON：{"字段": {"old": ..., "new": ...}}，敏感字段已脱敏
+	IP         string    `json:"IP"`
+}
+
+// NotificationChannel 通知渠道，可同时配置并启用多个
+type NotificationChannel struct {
+	gorm.Model
+	Name     string `gorm:"unique;not null" json:"Name"`
+	Type     string `gorm:"not null" json:"Type"` // webhook、telegram ...
+	Enabled  bool   `json:"Enabled"`
+	Settings string `json:"Settings"` // 渠道配置 JSON，字段因类型而异
+	Events   string `json:"Events"`   // 订阅的事件，逗号分隔，为空表示全部
+	Format   string `json:"Format"`   // 消息格式 plain、markdown、html，为空时使用渠道类型的默认格式
+	TaskIDs  string `json:"TaskIDs"`  // 只接收这些任务的事件，逗号分隔，为空表示全部任务
+
+	// 汇总模式：事件先暂存，按小时或每天定时合并为一条消息发送
+	DigestMode   string     `json:"DigestMode"`                        // 为空表示实时发送，hourly、daily
+	DigestTime   string     `gorm:"default:'09:00'" json:"DigestTime"` // daily 模式的发送时间 HH:MM
+	LastDigestAt *time.Time `json:"LastDigestAt"`
+
+	// 最近一次投递结果
+	LastSentAt *time.Time `json:"LastSentAt"`
+	LastStatus string     `json:"LastStatus"`
+	LastError  string     `json:"LastError"`
+}
+
+// NotificationTemplate 自定义通知模板，覆盖内置的默认模板
+type NotificationTemplate struct {
+	ID        uint      `gorm:"primarykey" json:"ID"`
+	Event     string    `gorm:"not null;uniqueIndex:idx_template_event_format" json:"Event"`
+	Format    string    `gorm:"uniqueIndex:idx_template_event_format" json:"Format"` // 为空表示适用于所有格式
+	Title     string    `json:"Title"`
+	Body      string    `json:"Body"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
+
+// NotificationDigestItem 汇总模式下等待合并发送的事件
+type NotificationDigestItem struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	ChannelID uint `gorm:"index"`
+	Event     string
+	Title     string
+}
+
+// 通知投递状态
+const (
+	DeliveryPending = "pending" // 等待发送或等待重试
+	DeliverySent    = "sent"
+	DeliveryDead    = "dead" // 重试次数用尽
+)
+
+// NotificationDelivery 通知发件箱，每条记录对应一个渠道的一次投递
+type NotificationDelivery struct {
+	ID            uint       `gorm:"primarykey" json:"ID"`
+	CreatedAt     time.Time  `json:"CreatedAt"`
+	UpdatedAt     time.Time  `json:"UpdatedAt"`
+	ChannelID     uint       `gorm:"index" json:"ChannelID"`
+	ChannelName   string     `json:"ChannelName"`
+	Event         string     `json:"Event"`
+	Title         string     `json:"Title"`
+	Body          string     `json:"Body"`
+	Format        string     `json:"Format"`
+	Payload       string     `json:"Payload"` // 原始事件数据 JSON，供结构化 Webhook 使用
+	Status        string     `gorm:"index;default:'pending'" json:"Status"`
+	Attempts      int        `json:"Attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"NextAttemptAt"`
+	LastError     string     `json:"LastError"`
+	SentAt        *time.Time `json:"SentAt"`
+}
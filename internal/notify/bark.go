@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BarkNotifier iOS Bark 推送
+type BarkNotifier struct {
+	Server    string `json:"server"` // 默认 https://api.day.app，可填自建服务
+	DeviceKey string `json:"deviceKey"`
+	Group     string `json:"group"`
+	Sound     string `json:"sound"`
+	Icon      string `json:"icon"`
+}
+
+func init() {
+	Register("bark", func(settings json.RawMessage) (Notifier, error) {
+		n := &BarkNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.DeviceKey == "" {
+			return nil, fmt.Errorf("Bark DeviceKey 不能为空")
+		}
+		if n.Server == "" {
+			n.Server = "https://api.day.app"
+		}
+		if n.Group == "" {
+			n.Group = "CloudStream"
+		}
+		return n, nil
+	})
+}
+
+func (n *BarkNotifier) Send(msg Message) error {
+	payload := map[string]string{
+		"device_key": n.DeviceKey,
+		"title":      msg.Title,
+		"body":       msg.Body,
+		"group":      n.Group,
+	}
+	if n.Sound != "" {
+		payload["sound"] = n.Sound
+	}
+	if n.Icon != "" {
+		payload["icon"] = n.Icon
+	}
+	body, err := postJSON(strings.TrimRight(n.Server, "/")+"/push", payload, nil)
+	if err != nil {
+		return err
+	}
+	return checkJSONCode(body, "code", 200)
+}
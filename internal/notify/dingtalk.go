@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DingTalkNotifier 钉钉群机器人，支持“加签”安全设置
+type DingTalkNotifier struct {
+	WebhookURL  string `json:"webhookUrl"` // 完整地址，或只填 AccessToken
+	AccessToken string `json:"accessToken"`
+	Secret      string `json:"secret"` // 加签密钥 (SEC 开头)，可选
+}
+
+func init() {
+	Register("dingtalk", func(settings json.RawMessage) (Notifier, error) {
+		n := &DingTalkNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.WebhookURL == "" {
+			if n.AccessToken == "" {
+				return nil, fmt.Errorf("钉钉机器人地址或 AccessToken 不能为空")
+			}
+			n.WebhookURL = "https://oapi.dingtalk.com/robot/send?access_token=" + n.AccessToken
+		}
+		return n, nil
+	})
+}
+
+// dingTalkSign 签名算法: Base64(HmacSHA256(secret, timestamp + "\n" + secret))
+func dingTalkSign(timestamp int64, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (n *DingTalkNotifier) Send(msg Message) error {
+	target := n.WebhookURL
+	if n.Secret != "" {
+		timestamp := time.Now().UnixMilli()
+		sep := "&"
+		if !strings.Contains(target, "?") {
+			sep = "?"
+		}
+		target = fmt.Sprintf("%s%stimestamp=%d&sign=%s", target, sep, timestamp, url.QueryEscape(dingTalkSign(timestamp, n.Secret)))
+	}
+	payload := map[string]interface{}{
+		"msgtype": "text",
+		"text": map[string]string{
+			"content": fmt.Sprintf("%s\n%s", msg.Title, msg.Body),
+		},
+	}
+	if msg.Format == FormatMarkdown {
+		payload = map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": msg.Title,
+				"text":  fmt.Sprintf("### %s\n%s", msg.Title, msg.Body),
+			},
+		}
+	}
+	body, err := postJSON(target, payload, nil)
+	if err != nil {
+		return err
+	}
+	return checkJSONCode(body, "errcode", 0)
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DiscordNotifier Discord 频道 Webhook
+type DiscordNotifier struct {
+	WebhookURL string `json:"webhookUrl"`
+	Username   string `json:"username"`
+}
+
+func init() {
+	Register("discord", func(settings json.RawMessage) (Notifier, error) {
+		n := &DiscordNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.WebhookURL == "" {
+			return nil, fmt.Errorf("Discord Webhook 地址不能为空")
+		}
+		if n.Username == "" {
+			n.Username = "CloudStream"
+		}
+		return n, nil
+	})
+}
+
+func (n *DiscordNotifier) Send(msg Message) error {
+	// Discord embed 描述最多 4096 个字符
+	description := msg.Body
+	if runes := []rune(description); len(runes) > 4000 {
+		description = string(runes[:4000]) + "..."
+	}
+	payload := map[string]interface{}{
+		"username": n.Username,
+		"embeds": []map[string]interface{}{
+			{"title": msg.Title, "description": description},
+		},
+	}
+	_, err := postJSON(n.WebhookURL, payload, nil)
+	return err
+}
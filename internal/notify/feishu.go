@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// FeishuNotifier 飞书 / Lark 群机器人，支持签名校验
+type FeishuNotifier struct {
+	WebhookURL string `json:"webhookUrl"`
+	Secret     string `json:"secret"` // 签名校验密钥，可选
+}
+
+func init() {
+	Register("feishu", func(settings json.RawMessage) (Notifier, error) {
+		n := &FeishuNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.WebhookURL == "" {
+			return nil, fmt.Errorf("飞书机器人地址不能为空")
+		}
+		return n, nil
+	})
+}
+
+// feishuSign 签名算法: Base64(HmacSHA256(key = timestamp + "\n" + secret, message = 空))
+func feishuSign(timestamp int64, secret string) string {
+	mac := hmac.New(sha256.New, []byte(strconv.FormatInt(timestamp, 10)+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (n *FeishuNotifier) Send(msg Message) error {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content": map[string]string{
+			"text": fmt.Sprintf("%s\n%s", msg.Title, msg.Body),
+		},
+	}
+	if n.Secret != "" {
+		timestamp := time.Now().Unix()
+		payload["timestamp"] = strconv.FormatInt(timestamp, 10)
+		payload["sign"] = feishuSign(timestamp, n.Secret)
+	}
+	body, err := postJSON(n.WebhookURL, payload, nil)
+	if err != nil {
+		return err
+	}
+	return checkJSONCode(body, "code", 0)
+}
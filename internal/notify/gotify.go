@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GotifyNotifier 自建 Gotify 服务
+type GotifyNotifier struct {
+	Server   string `json:"server"`
+	Token    string `json:"token"` // 应用令牌
+	Priority int    `json:"priority"`
+}
+
+func init() {
+	Register("gotify", func(settings json.RawMessage) (Notifier, error) {
+		n := &GotifyNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.Server == "" || n.Token == "" {
+			return nil, fmt.Errorf("Gotify 服务地址和应用令牌不能为空")
+		}
+		if n.Priority == 0 {
+			n.Priority = 5
+		}
+		return n, nil
+	})
+}
+
+func (n *GotifyNotifier) Send(msg Message) error {
+	payload := map[string]interface{}{
+		"title":    msg.Title,
+		"message":  msg.Body,
+		"priority": n.Priority,
+	}
+	if msg.Format == FormatMarkdown {
+		payload["extras"] = map[string]interface{}{
+			"client::display": map[string]string{"contentType": "text/markdown"},
+		}
+	}
+	_, err := postJSON(strings.TrimRight(n.Server, "/")+"/message", payload, map[string]string{"X-Gotify-Key": n.Token})
+	return err
+}
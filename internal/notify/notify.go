@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 事件类型
+const (
+	EventTaskSuccess         = "task_success"
+	EventTaskFailure         = "task_failure"
+	EventTaskStopped         = "task_stopped"
+	EventFilesDeleted        = "files_deleted"
+	EventFilesAdded          = "files_added"
+	EventAccountTokenFailure = "account_token_failure"
+	EventLoginAlert          = "login_alert"
+	EventDigest              = "digest"
+	EventTest                = "test"
+)
+
+// Events 渠道可订阅的事件
+var Events = []string{
+	EventTaskSuccess,
+	EventTaskFailure,
+	EventTaskStopped,
+	EventFilesDeleted,
+	EventFilesAdded,
+	EventAccountTokenFailure,
+	EventLoginAlert,
+}
+
+// Message 发送给各渠道的一条通知
+type Message struct {
+	ID     string // 投递 ID，接收方可用于去重
+	Event  string
+	Title  string
+	Body   string
+	Format string     // 正文格式: plain、markdown、html，空值按纯文本处理
+	Data   *EventData // 原始事件数据，供结构化负载使用
+}
+
+// Notifier 通知渠道的统一接口
+type Notifier interface {
+	Send(msg Message) error
+}
+
+// Factory 根据渠道的 JSON 配置创建 Notifier
+type Factory func(settings json.RawMessage) (Notifier, error)
+
+var factories = make(map[string]Factory)
+
+// Register 注册一种渠道类型，在各实现文件的 init 中调用
+func Register(channelType string, factory Factory) {
+	factories[channelType] = factory
+}
+
+// New 按渠道类型和配置创建 Notifier
+func New(channelType, settings string) (Notifier, error) {
+	factory, ok := factories[channelType]
+	if !ok {
+		return nil, fmt.Errorf("不支持的通知渠道类型: %s", channelType)
+	}
+	if strings.TrimSpace(settings) == "" {
+		settings = "{}"
+	}
+	return factory(json.RawMessage(settings))
+}
+
+// Types 返回所有已注册的渠道类型
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON 发送 JSON 请求，非 2xx 响应视为失败
+func postJSON(url string, payload interface{}, headers map[string]string) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("编码通知内容失败: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return doRequest(req)
+}
+
+func doRequest(req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// checkJSONCode 部分服务出错时仍返回 HTTP 200，需要检查响应体中的状态码字段
+func checkJSONCode(body []byte, field string, okValue int) error {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+	code, ok := resp[field].(float64)
+	if !ok || int(code) == okValue {
+		return nil
+	}
+	msg := ""
+	for _, key := range []string{"errmsg", "msg", "message", "error"} {
+		if v, ok := resp[key].(string); ok && v != "" {
+			msg = v
+			break
+		}
+	}
+	return fmt.Errorf("%s=%d: %s", field, int(code), msg)
+}
+
+func decodeSettings(settings json.RawMessage, out interface{}) error {
+	if err := json.Unmarshal(settings, out); err != nil {
+		return fmt.Errorf("解析渠道配置失败: %w", err)
+	}
+	return nil
+}
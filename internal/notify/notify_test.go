@@ -0,0 +1,375 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capturedRequest 模拟服务端收到的请求
+type capturedRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+func (r capturedRequest) json(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var v map[string]interface{}
+	if err := json.Unmarshal(r.Body, &v); err != nil {
+		t.Fatalf("请求体不是 JSON: %v: %s", err, r.Body)
+	}
+	return v
+}
+
+// newCaptureServer 启动记录请求的模拟服务，响应固定内容
+func newCaptureServer(t *testing.T, status int, response string) (*httptest.Server, *[]capturedRequest) {
+	t.Helper()
+	var requests []capturedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, capturedRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.Query(),
+			Header: r.Header.Clone(),
+			Body:   body,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func mustSettings(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+var testMessage = Message{ID: "delivery-1", Event: EventTaskSuccess, Title: "任务完成", Body: "新增 3 个文件"}
+
+func TestHTTPNotifiers(t *testing.T) {
+	cases := []struct {
+		name     string
+		typ      string
+		settings func(base string) interface{}
+		response string
+		msg      Message
+		check    func(t *testing.T, req capturedRequest)
+	}{
+		{
+			name: "bark",
+			typ:  "bark",
+			settings: func(base string) interface{} {
+				return map[string]string{"server": base + "/", "deviceKey": "dev", "sound": "bell"}
+			},
+			response: `{"code":200}`,
+			check: func(t *testing.T, req capturedRequest) {
+				body := req.json(t)
+				if req.Path != "/push" || body["device_key"] != "dev" || body["title"] != "任务完成" || body["group"] != "CloudStream" || body["sound"] != "bell" {
+					t.Errorf("请求不符合预期: %s %s", req.Path, req.Body)
+				}
+			},
+		},
+		{
+			name: "dingtalk signed markdown",
+			typ:  "dingtalk",
+			settings: func(base string) interface{} {
+				return map[string]string{"webhookUrl": base + "/robot/send?access_token=abc", "secret": "SECkey"}
+			},
+			response: `{"errcode":0}`,
+			msg:      Message{Event: EventTaskSuccess, Title: "任务完成", Body: "**3**", Format: FormatMarkdown},
+			check: func(t *testing.T, req capturedRequest) {
+				ts, err := strconv.ParseInt(req.Query.Get("timestamp"), 10, 64)
+				if err != nil || req.Query.Get("access_token") != "abc" {
+					t.Fatalf("签名参数缺失: %v", req.Query)
+				}
+				if req.Query.Get("sign") != dingTalkSign(ts, "SECkey") {
+					t.Errorf("签名错误: %s", req.Query.Get("sign"))
+				}
+				body := req.json(t)
+				markdown, _ := body["markdown"].(map[string]interface{})
+				if body["msgtype"] != "markdown" || markdown["text"] != "### 任务完成\n**3**" {
+					t.Errorf("请求体不符合预期: %s", req.Body)
+				}
+			},
+		},
+		{
+			name:     "discord",
+			typ:      "discord",
+			settings: func(base string) interface{} { return map[string]string{"webhookUrl": base + "/api/webhooks/1/token"} },
+			check: func(t *testing.T, req capturedRequest) {
+				body := req.json(t)
+				embeds, _ := body["embeds"].([]interface{})
+				if req.Path != "/api/webhooks/1/token" || body["username"] != "CloudStream" || len(embeds) != 1 {
+					t.Fatalf("请求不符合预期: %s", req.Body)
+				}
+				embed := embeds[0].(map[string]interface{})
+				if embed["title"] != "任务完成" || embed["description"] != "新增 3 个文件" {
+					t.Errorf("embed 内容错误: %v", embed)
+				}
+			},
+		},
+		{
+			name: "feishu signed",
+			typ:  "feishu",
+			settings: func(base string) interface{} {
+				return map[string]string{"webhookUrl": base + "/hook/x", "secret": "fs"}
+			},
+			response: `{"code":0}`,
+			check: func(t *testing.T, req capturedRequest) {
+				body := req.json(t)
+				ts, err := strconv.ParseInt(body["timestamp"].(string), 10, 64)
+				if err != nil || body["sign"] != feishuSign(ts, "fs") {
+					t.Errorf("签名错误: %s", req.Body)
+				}
+				content, _ := body["content"].(map[string]interface{})
+				if body["msg_type"] != "text" || content["text"] != "任务完成\n新增 3 个文件" {
+					t.Errorf("请求体不符合预期: %s", req.Body)
+				}
+			},
+		},
+		{
+			name:     "gotify",
+			typ:      "gotify",
+			settings: func(base string) interface{} { return map[string]string{"server": base, "token": "app-token"} },
+			msg:      Message{Event: EventTaskSuccess, Title: "任务完成", Body: "ok", Format: FormatMarkdown},
+			check: func(t *testing.T, req capturedRequest) {
+				body := req.json(t)
+				if req.Path != "/message" || req.Header.Get("X-Gotify-Key") != "app-token" || body["priority"] != float64(5) {
+					t.Errorf("请求不符合预期: %s %v %s", req.Path, req.Header, req.Body)
+				}
+				if _, ok := body["extras"]; !ok {
+					t.Errorf("Markdown 消息缺少 extras: %s", req.Body)
+				}
+			},
+		},
+		{
+			name: "ntfy",
+			typ:  "ntfy",
+			settings: func(base string) interface{} {
+				return map[string]interface{}{"server": base, "topic": "media", "token": "tk", "tags": "tv, film", "priority": 4}
+			},
+			check: func(t *testing.T, req capturedRequest) {
+				body := req.json(t)
+				tags, _ := body["tags"].([]interface{})
+				if req.Header.Get("Authorization") != "Bearer tk" || body["topic"] != "media" || body["priority"] != float64(4) || len(tags) != 2 || tags[1] != "film" {
+					t.Errorf("请求不符合预期: %v %s", req.Header, req.Body)
+				}
+			},
+		},
+		{
+			name:     "serverchan",
+			typ:      "serverchan",
+			settings: func(base string) interface{} { return map[string]string{"server": base, "sendKey": "SCT123"} },
+			response: `{"code":0}`,
+			check: func(t *testing.T, req capturedRequest) {
+				form, _ := url.ParseQuery(string(req.Body))
+				if req.Path != "/SCT123.send" || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+					t.Fatalf("请求不符合预期: %s %v", req.Path, req.Header)
+				}
+				if form.Get("title") != "任务完成" || form.Get("desp") != "新增 3 个文件" {
+					t.Errorf("表单内容错误: %s", req.Body)
+				}
+			},
+		},
+		{
+			name:     "slack",
+			typ:      "slack",
+			settings: func(base string) interface{} { return map[string]string{"webhookUrl": base + "/services/T/B/X"} },
+			check: func(t *testing.T, req capturedRequest) {
+				if body := req.json(t); body["text"] != "*任务完成*\n新增 3 个文件" {
+					t.Errorf("请求体不符合预期: %s", req.Body)
+				}
+			},
+		},
+		{
+			name: "telegram html",
+			typ:  "telegram",
+			settings: func(base string) interface{} {
+				return map[string]string{"apiUrl": base, "token": "123:abc", "chatId": "42"}
+			},
+			msg: Message{Event: EventTaskSuccess, Title: "a<b", Body: "<i>x</i>", Format: FormatHTML},
+			check: func(t *testing.T, req capturedRequest) {
+				body := req.json(t)
+				if req.Path != "/bot123:abc/sendMessage" || body["chat_id"] != "42" || body["parse_mode"] != "HTML" || body["text"] != "<b>a&lt;b</b>\n<i>x</i>" {
+					t.Errorf("请求不符合预期: %s %s", req.Path, req.Body)
+				}
+			},
+		},
+		{
+			name: "wecom",
+			typ:  "wecom",
+			settings: func(base string) interface{} {
+				return map[string]string{"webhookUrl": base + "/cgi-bin/webhook/send?key=k"}
+			},
+			response: `{"errcode":0}`,
+			check: func(t *testing.T, req capturedRequest) {
+				body := req.json(t)
+				text, _ := body["text"].(map[string]interface{})
+				if req.Query.Get("key") != "k" || body["msgtype"] != "text" || text["content"] != "任务完成\n新增 3 个文件" {
+					t.Errorf("请求不符合预期: %v %s", req.Query, req.Body)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, requests := newCaptureServer(t, http.StatusOK, tc.response)
+			n, err := New(tc.typ, mustSettings(t, tc.settings(srv.URL)))
+			if err != nil {
+				t.Fatalf("创建渠道失败: %v", err)
+			}
+			msg := tc.msg
+			if msg.Event == "" {
+				msg = testMessage
+			}
+			if err := n.Send(msg); err != nil {
+				t.Fatalf("发送失败: %v", err)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("收到 %d 个请求", len(*requests))
+			}
+			req := (*requests)[0]
+			if req.Method != http.MethodPost {
+				t.Errorf("请求方法为 %s", req.Method)
+			}
+			tc.check(t, req)
+		})
+	}
+}
+
+func TestHTTPNotifierErrors(t *testing.T) {
+	// HTTP 200 但响应体中的状态码表示失败
+	srv, _ := newCaptureServer(t, http.StatusOK, `{"errcode":93000,"errmsg":"invalid webhook url"}`)
+	n, err := New("wecom", mustSettings(t, map[string]string{"webhookUrl": srv.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(testMessage); err == nil || !strings.Contains(err.Error(), "invalid webhook url") {
+		t.Errorf("应返回服务端错误信息，实际: %v", err)
+	}
+
+	srv, _ = newCaptureServer(t, http.StatusForbidden, `forbidden`)
+	n, err = New("slack", mustSettings(t, map[string]string{"webhookUrl": srv.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(testMessage); err == nil || !strings.Contains(err.Error(), "HTTP 403") {
+		t.Errorf("非 2xx 响应应视为失败，实际: %v", err)
+	}
+}
+
+func TestWebhookLegacyPayload(t *testing.T) {
+	srv, requests := newCaptureServer(t, http.StatusOK, "")
+	n, err := New("webhook", mustSettings(t, map[string]string{"url": srv.URL + "/hook"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(testMessage); err != nil {
+		t.Fatal(err)
+	}
+	req := (*requests)[0]
+	body := req.json(t)
+	if body["title"] != "任务完成" || body["content"] != "新增 3 个文件" || body["msg"] != "新增 3 个文件" {
+		t.Errorf("旧版负载字段错误: %s", req.Body)
+	}
+	if req.Header.Get(HeaderEvent) != EventTaskSuccess || req.Header.Get(HeaderDelivery) != "delivery-1" {
+		t.Errorf("事件请求头错误: %v", req.Header)
+	}
+	if req.Header.Get(HeaderSignature) != "" {
+		t.Error("未配置密钥时不应签名")
+	}
+}
+
+func TestWebhookSignedPayload(t *testing.T) {
+	srv, requests := newCaptureServer(t, http.StatusOK, "")
+	n, err := New("webhook", mustSettings(t, map[string]interface{}{
+		"url":            srv.URL,
+		"method":         "put",
+		"secret":         "whsec",
+		"payloadVersion": 1,
+		"headers":        map[string]string{"X-Custom": "1"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := testMessage
+	msg.Data = &EventData{
+		Event:          EventTaskSuccess,
+		OccurredAt:     started.Add(2 * time.Minute),
+		TaskID:         7,
+		TaskName:       "tv",
+		AccountName:    "main",
+		Status:         "成功",
+		ProcessedCount: 10,
+		AddedCount:     1,
+		AddedFiles:     []string{"/tv/a.strm"},
+		StartedAt:      started,
+		FinishedAt:     started.Add(90 * time.Second),
+		Duration:       90 * time.Second,
+	}
+	if err := n.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	req := (*requests)[0]
+	if req.Method != http.MethodPut || req.Header.Get("X-Custom") != "1" {
+		t.Errorf("请求方法或自定义头错误: %s %v", req.Method, req.Header)
+	}
+	timestamp := req.Header.Get(HeaderTimestamp)
+	if timestamp == "" || req.Header.Get(HeaderSignature) != SignPayload("whsec", timestamp, req.Body) {
+		t.Errorf("签名错误: %v", req.Header)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(req.Body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Version != PayloadVersion || payload.ID != "delivery-1" || payload.Event != EventTaskSuccess {
+		t.Errorf("负载头部字段错误: %s", req.Body)
+	}
+	// 负载时间为事件发生时间，而非发送 (重试) 时间
+	if !payload.Timestamp.Equal(started.Add(2 * time.Minute)) {
+		t.Errorf("负载时间错误: %v", payload.Timestamp)
+	}
+	if payload.Task == nil || payload.Task.ID != 7 || payload.Account == nil || payload.Account.Name != "main" {
+		t.Errorf("任务或账户字段错误: %s", req.Body)
+	}
+	if payload.Run == nil || payload.Run.ProcessedCount != 10 || payload.Run.DurationSeconds != 90 || len(payload.Run.AddedFiles) != 1 || payload.Run.DeletedFiles == nil {
+		t.Errorf("运行统计字段错误: %s", req.Body)
+	}
+}
+
+func TestWebhookBodyTemplate(t *testing.T) {
+	srv, requests := newCaptureServer(t, http.StatusOK, "")
+	n, err := New("webhook", mustSettings(t, map[string]string{
+		"url":          srv.URL,
+		"bodyTemplate": `{"text":{{json .Title}},"event":"{{.Event}}"}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(testMessage); err != nil {
+		t.Fatal(err)
+	}
+	if body := string((*requests)[0].Body); body != `{"text":"任务完成","event":"task_success"}` {
+		t.Errorf("模板渲染结果错误: %s", body)
+	}
+}
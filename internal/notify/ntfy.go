@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// NtfyNotifier ntfy.sh 或自建 ntfy 服务
+type NtfyNotifier struct {
+	Server   string `json:"server"` // 默认 https://ntfy.sh
+	Topic    string `json:"topic"`
+	Token    string `json:"token"` // 访问令牌，可选
+	Priority int    `json:"priority"`
+	Tags     string `json:"tags"` // 逗号分隔
+}
+
+func init() {
+	Register("ntfy", func(settings json.RawMessage) (Notifier, error) {
+		n := &NtfyNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.Topic == "" {
+			return nil, fmt.Errorf("ntfy Topic 不能为空")
+		}
+		if n.Server == "" {
+			n.Server = "https://ntfy.sh"
+		}
+		return n, nil
+	})
+}
+
+func (n *NtfyNotifier) Send(msg Message) error {
+	// 使用 JSON 发布接口，避免中文标题放在 HTTP 头中的编码问题
+	payload := map[string]interface{}{
+		"topic":   n.Topic,
+		"title":   msg.Title,
+		"message": msg.Body,
+	}
+	if msg.Format == FormatMarkdown {
+		payload["markdown"] = true
+	}
+	if n.Priority > 0 {
+		payload["priority"] = n.Priority
+	}
+	if n.Tags != "" {
+		var tags []string
+		for _, t := range strings.Split(n.Tags, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+		payload["tags"] = tags
+	}
+	headers := map[string]string{}
+	if n.Token != "" {
+		headers["Authorization"] = "Bearer " + n.Token
+	}
+	_, err := postJSON(strings.TrimRight(n.Server, "/"), payload, headers)
+	return err
+}
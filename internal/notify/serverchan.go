@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ServerChanNotifier Server 酱 (Turbo 与 Server3)
+type ServerChanNotifier struct {
+	SendKey string `json:"sendKey"`
+	Server  string `json:"server"` // 可选，覆盖默认推送地址
+}
+
+var serverChan3Key = regexp.MustCompile(`^sctp(\d+)t`)
+
+func init() {
+	Register("serverchan", func(settings json.RawMessage) (Notifier, error) {
+		n := &ServerChanNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.SendKey == "" {
+			return nil, fmt.Errorf("Server 酱 SendKey 不能为空")
+		}
+		return n, nil
+	})
+}
+
+func (n *ServerChanNotifier) endpoint() string {
+	if n.Server != "" {
+		return fmt.Sprintf("%s/%s.send", strings.TrimRight(n.Server, "/"), n.SendKey)
+	}
+	if m := serverChan3Key.FindStringSubmatch(n.SendKey); m != nil {
+		return fmt.Sprintf("https://%s.push.ft07.com/send/%s.send", m[1], n.SendKey)
+	}
+	return fmt.Sprintf("https://sctapi.ftqq.com/%s.send", n.SendKey)
+}
+
+func (n *ServerChanNotifier) Send(msg Message) error {
+	form := url.Values{}
+	form.Set("title", msg.Title)
+	form.Set("desp", msg.Body)
+	req, err := http.NewRequest(http.MethodPost, n.endpoint(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := doRequest(req)
+	if err != nil {
+		return err
+	}
+	return checkJSONCode(body, "code", 0)
+}
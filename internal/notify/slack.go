@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SlackNotifier Slack Incoming Webhook
+type SlackNotifier struct {
+	WebhookURL string `json:"webhookUrl"`
+}
+
+func init() {
+	Register("slack", func(settings json.RawMessage) (Notifier, error) {
+		n := &SlackNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.WebhookURL == "" {
+			return nil, fmt.Errorf("Slack Webhook 地址不能为空")
+		}
+		return n, nil
+	})
+}
+
+func (n *SlackNotifier) Send(msg Message) error {
+	payload := map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", msg.Title, msg.Body),
+	}
+	_, err := postJSON(n.WebhookURL, payload, nil)
+	return err
+}
@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier 邮件通知
+type SMTPNotifier struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	To       string `json:"to"`       // 多个收件人用逗号分隔
+	Security string `json:"security"` // none、starttls、ssl
+
+	from *mail.Address
+	to   []*mail.Address
+}
+
+func init() {
+	Register("smtp", func(settings json.RawMessage) (Notifier, error) {
+		n := &SMTPNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.Host == "" || n.To == "" {
+			return nil, fmt.Errorf("SMTP 服务器和收件人不能为空")
+		}
+		if n.From == "" {
+			n.From = n.Username
+		}
+		if n.From == "" {
+			return nil, fmt.Errorf("发件人不能为空")
+		}
+		// 支持 "名称 <地址>" 形式，信封中只能使用纯地址
+		from, err := mail.ParseAddress(n.From)
+		if err != nil {
+			return nil, fmt.Errorf("发件人地址无效: %w", err)
+		}
+		n.from = from
+		for _, addr := range strings.Split(n.To, ",") {
+			if addr = strings.TrimSpace(addr); addr == "" {
+				continue
+			}
+			rcpt, err := mail.ParseAddress(addr)
+			if err != nil {
+				return nil, fmt.Errorf("收件人地址 %s 无效: %w", addr, err)
+			}
+			n.to = append(n.to, rcpt)
+		}
+		if len(n.to) == 0 {
+			return nil, fmt.Errorf("SMTP 服务器和收件人不能为空")
+		}
+		if n.Security == "" {
+			n.Security = "starttls"
+		}
+		if n.Port == 0 {
+			switch n.Security {
+			case "ssl":
+				n.Port = 465
+			case "none":
+				n.Port = 25
+			default:
+				n.Port = 587
+			}
+		}
+		return n, nil
+	})
+}
+
+func (n *SMTPNotifier) buildMessage(msg Message) []byte {
+	to := make([]string, 0, len(n.to))
+	for _, addr := range n.to {
+		to = append(to, addr.String())
+	}
+	var b strings.Builder
+	b.WriteString("From: " + n.from.String() + "\r\n")
+	b.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", msg.Title) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	content := msg.Body
+	if msg.Format == FormatHTML {
+		b.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+		content = "<html><body>" + strings.ReplaceAll(msg.Body, "\n", "<br>\n") + "</body></html>"
+	} else {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	}
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return []byte(b.String())
+}
+
+func (n *SMTPNotifier) Send(msg Message) error {
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	tlsConfig := &tls.Config{ServerName: n.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if n.Security == "ssl" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP 握手失败: %w", err)
+	}
+	defer client.Close()
+
+	if n.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP 服务器不支持 STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS 失败: %w", err)
+		}
+	}
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.from.Address); err != nil {
+		return fmt.Errorf("设置发件人失败: %w", err)
+	}
+	for _, rcpt := range n.to {
+		if err := client.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("设置收件人 %s 失败: %w", rcpt.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	if _, err := w.Write(n.buildMessage(msg)); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	return client.Quit()
+}
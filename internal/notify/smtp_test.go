@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer 只实现发信所需命令的本地 SMTP 服务，记录会话内容
+type fakeSMTPServer struct {
+	ln       net.Listener
+	done     chan struct{}
+	auth     string
+	mailFrom string
+	rcptTo   []string
+	data     string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{ln: ln, done: make(chan struct{})}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN "):
+			s.auth = line[len("AUTH PLAIN "):]
+			reply("235 authenticated")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mailFrom = line[len("MAIL FROM:"):]
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcptTo = append(s.rcptTo, line[len("RCPT TO:"):])
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				b.WriteString(dataLine)
+			}
+			s.data = b.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	n, err := New("smtp", mustSettings(t, map[string]interface{}{
+		"host":     "127.0.0.1",
+		"port":     srv.port(),
+		"username": "mailer",
+		"password": "pw",
+		"from":     "CloudStream 通知 <bot@example.com>",
+		"to":       "Alice <alice@example.com>, bob@example.com",
+		"security": "none",
+	}))
+	if err != nil {
+		t.Fatalf("创建渠道失败: %v", err)
+	}
+	if err := n.Send(testMessage); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	<-srv.done
+
+	if auth, _ := base64.StdEncoding.DecodeString(srv.auth); string(auth) != "\x00mailer\x00pw" {
+		t.Errorf("认证信息错误: %q", auth)
+	}
+	// 信封中只能出现纯地址
+	if srv.mailFrom != "<bot@example.com>" {
+		t.Errorf("MAIL FROM 错误: %s", srv.mailFrom)
+	}
+	if len(srv.rcptTo) != 2 || srv.rcptTo[0] != "<alice@example.com>" || srv.rcptTo[1] != "<bob@example.com>" {
+		t.Errorf("RCPT TO 错误: %v", srv.rcptTo)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(srv.data))
+	if err != nil {
+		t.Fatalf("邮件格式错误: %v\n%s", err, srv.data)
+	}
+	from, err := parsed.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "CloudStream 通知" || from[0].Address != "bot@example.com" {
+		t.Errorf("From 头错误: %v %v", from, err)
+	}
+	to, err := parsed.Header.AddressList("To")
+	if err != nil || len(to) != 2 || to[0].Name != "Alice" {
+		t.Errorf("To 头错误: %v %v", to, err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != testMessage.Title {
+		t.Errorf("主题错误: %s", subject)
+	}
+	raw, _ := io.ReadAll(parsed.Body)
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	if err != nil || string(body) != testMessage.Body {
+		t.Errorf("正文错误: %q %v", body, err)
+	}
+}
+
+func TestSMTPNotifierRejectsInvalidAddress(t *testing.T) {
+	for _, settings := range []map[string]string{
+		{"host": "127.0.0.1", "from": "not an address", "to": "a@example.com"},
+		{"host": "127.0.0.1", "from": "bot@example.com", "to": "a@example.com, broken <"},
+	} {
+		if _, err := New("smtp", mustSettings(t, settings)); err == nil {
+			t.Errorf("无效地址应被拒绝: %v", settings)
+		}
+	}
+}
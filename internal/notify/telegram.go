@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// TelegramNotifier 通过 Bot API 推送消息
+type TelegramNotifier struct {
+	Token  string `json:"token"`
+	ChatID string `json:"chatId"`
+	APIURL string `json:"apiUrl"` // 可选，自建 Bot API 或反代地址
+}
+
+func init() {
+	Register("telegram", func(settings json.RawMessage) (Notifier, error) {
+		n := &TelegramNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.Token == "" || n.ChatID == "" {
+			return nil, fmt.Errorf("Telegram Token 和 ChatID 不能为空")
+		}
+		if n.APIURL == "" {
+			n.APIURL = "https://api.telegram.org"
+		}
+		return n, nil
+	})
+}
+
+func (n *TelegramNotifier) Send(msg Message) error {
+	apiURL := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(n.APIURL, "/"), n.Token)
+	payload := map[string]string{
+		"chat_id": n.ChatID,
+		"text":    fmt.Sprintf("%s\n%s", msg.Title, msg.Body),
+	}
+	switch msg.Format {
+	case FormatHTML:
+		payload["text"] = fmt.Sprintf("<b>%s</b>\n%s", html.EscapeString(msg.Title), msg.Body)
+		payload["parse_mode"] = "HTML"
+	case FormatMarkdown:
+		payload["text"] = fmt.Sprintf("*%s*\n%s", msg.Title, msg.Body)
+		payload["parse_mode"] = "Markdown"
+	}
+	if _, err := postJSON(apiURL, payload, nil); err != nil {
+		return fmt.Errorf("Telegram API 错误: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 消息格式
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// 各渠道类型的默认消息格式，未列出的类型使用纯文本
+var defaultFormats = map[string]string{
+	"telegram": FormatHTML,
+	"smtp":     FormatHTML,
+	"wecom":    FormatMarkdown,
+	"dingtalk": FormatMarkdown,
+	"discord":  FormatMarkdown,
+	"slack":    FormatMarkdown,
+}
+
+// DefaultFormat 返回渠道类型的默认消息格式
+func DefaultFormat(channelType string) string {
+	if f, ok := defaultFormats[channelType]; ok {
+		return f
+	}
+	return FormatPlain
+}
+
+// ValidFormat 判断是否为支持的消息格式
+func ValidFormat(format string) bool {
+	return format == FormatPlain || format == FormatMarkdown || format == FormatHTML
+}
+
+// EventData 模板可用的事件变量
+type EventData struct {
+	Event          string        `json:"event"`
+	OccurredAt     time.Time     `json:"occurredAt"` // 事件发生时间，重试或汇总发送时保持不变
+	TaskID         uint          `json:"taskId,omitempty"`
+	TaskName       string        `json:"taskName,omitempty"`
+	SubPath        string        `json:"subPath,omitempty"` // 子目录扫描时的相对路径
+	AccountName    string        `json:"accountName,omitempty"`
+	Status         string        `json:"status,omitempty"`
+	ProcessedCount int           `json:"processedCount"`
+	AddedCount     int           `json:"addedCount"`
+	DeletedCount   int           `json:"deletedCount"`
+	Duration       time.Duration `json:"duration"`
+	StartedAt      time.Time     `json:"startedAt"`
+	FinishedAt     time.Time     `json:"finishedAt"`
+	Errors         []string      `json:"errors,omitempty"`
+	AddedFiles     []string      `json:"addedFiles,omitempty"`
+	AddedGroups    []FileGroup   `json:"addedGroups,omitempty"` // 新增媒体按目录分组，条目数有上限
+	AddedMore      int           `json:"addedMore,omitempty"`   // 超出上限未列出的新增数量
+	DeletedFiles   []string      `json:"deletedFiles,omitempty"`
+	FilesTruncated bool          `json:"filesTruncated,omitempty"` // 文件列表超出上限，只保留了前面的部分，总数见 AddedCount/DeletedCount
+	Message        string        `json:"message,omitempty"`        // 其他事件的附加说明 (如登录告警)
+	Entries        []DigestEntry `json:"entries,omitempty"`        // 汇总通知中的事件列表
+}
+
+// FileGroup 同一目录下的文件标题
+type FileGroup struct {
+	Folder string   `json:"folder"`
+	Titles []string `json:"titles"`
+}
+
+// DigestEntry 汇总通知中的一条事件
+type DigestEntry struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Title string    `json:"title"`
+}
+
+// Template 单个事件的标题与正文模板 (Go text/template 语法)
+type Template struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// DefaultTemplates 内置的默认模板
+var DefaultTemplates = map[string]Template{
+	EventTaskSuccess: {
+		Title: "任务完成: {{.TaskName}}",
+		Body: `任务 {{bold (esc .TaskName)}} 已执行完毕
+账户: {{esc .AccountName}}
+处理文件: {{.ProcessedCount}} 个
+耗时: {{duration .Duration}}{{if .DeletedCount}}
+清理失效文件: {{.DeletedCount}} 个{{end}}`,
+	},
+	EventTaskFailure: {
+		Title: "任务异常: {{.TaskName}}",
+		Body: `任务 {{bold (esc .TaskName)}} 执行过程中出现错误，出错的目录已跳过本地清理，其余目录已正常更新，下次执行时将从断点继续。
+账户: {{esc .AccountName}}
+已处理文件: {{.ProcessedCount}} 个
+耗时: {{duration .Duration}}{{if .Errors}}
+错误信息:{{range limit .Errors 5}}
+- {{code (esc .)}}{{end}}{{with more .Errors 5}}
+... 以及另外 {{.}} 条错误{{end}}{{end}}`,
+	},
+	EventTaskStopped: {
+		Title: "任务停止: {{.TaskName}}",
+		Body: `任务 {{bold (esc .TaskName)}} 已被手动停止
+已处理文件: {{.ProcessedCount}} 个
+耗时: {{duration .Duration}}`,
+	},
+	EventFilesDeleted: {
+		Title: "清理失效文件: {{.TaskName}}",
+		Body: `任务 {{bold (esc .TaskName)}} 清理了 {{.DeletedCount}} 个失效文件{{range limit .DeletedFiles 10}}
+- {{esc .}}{{end}}{{if gt .DeletedCount 10}}
+... 以及另外 {{sub .DeletedCount 10}} 个文件{{end}}`,
+	},
+	EventFilesAdded: {
+		Title: "新增媒体: {{.TaskName}}",
+		Body: `任务 {{bold (esc .TaskName)}} 新增了 {{.AddedCount}} 个媒体文件{{range .AddedGroups}}
+{{bold (esc .Folder)}}{{range .Titles}}
+- {{esc .}}{{end}}{{end}}{{with .AddedMore}}
+... 以及另外 {{.}} 个{{end}}`,
+	},
+	EventAccountTokenFailure: {
+		Title: "账户授权失败: {{.AccountName}}",
+		Body: `云账户 {{bold (esc .AccountName)}} 获取访问令牌失败，相关任务将无法执行，请检查账户凭证。
+{{code (esc .Message)}}`,
+	},
+	EventLoginAlert: {
+		Title: "登录异常告警",
+		Body:  `{{esc .Message}}`,
+	},
+	EventDigest: {
+		Title: "CloudStream 通知汇总 ({{len .Entries}} 条)",
+		Body: `{{esc .Message}}{{range .Entries}}
+- {{time .Time}} {{esc .Title}}{{end}}`,
+	},
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%d 小时 %d 分 %d 秒", h, m, s)
+	case m > 0:
+		return fmt.Sprintf("%d 分 %d 秒", m, s)
+	default:
+		return fmt.Sprintf("%d 秒", s)
+	}
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+
+func templateFuncs(format string) template.FuncMap {
+	return template.FuncMap{
+		"esc": func(s string) string {
+			switch format {
+			case FormatHTML:
+				return html.EscapeString(s)
+			case FormatMarkdown:
+				return markdownEscaper.Replace(s)
+			}
+			return s
+		},
+		"bold": func(s string) string {
+			switch format {
+			case FormatHTML:
+				return "<b>" + s + "</b>"
+			case FormatMarkdown:
+				return "**" + s + "**"
+			}
+			return "'" + s + "'"
+		},
+		"code": func(s string) string {
+			switch format {
+			case FormatHTML:
+				return "<code>" + s + "</code>"
+			case FormatMarkdown:
+				return "`" + s + "`"
+			}
+			return s
+		},
+		"limit": func(items []string, n int) []string {
+			if len(items) > n {
+				return items[:n]
+			}
+			return items
+		},
+		"more": func(items []string, n int) int {
+			if len(items) > n {
+				return len(items) - n
+			}
+			return 0
+		},
+		"sub":      func(a, b int) int { return a - b },
+		"join":     strings.Join,
+		"duration": formatDuration,
+		"time": func(t time.Time) string {
+			if t.IsZero() {
+				return "-"
+			}
+			return t.Format("2006-01-02 15:04:05")
+		},
+	}
+}
+
+func execute(name, text, format string, data EventData) (string, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs(format)).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析模板失败: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("渲染模板失败: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Render 按指定格式渲染模板；标题始终按纯文本渲染
+func Render(tpl Template, format string, data EventData) (string, string, error) {
+	title, err := execute("title", tpl.Title, FormatPlain, data)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := execute("body", tpl.Body, format, data)
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(title), strings.TrimSpace(body), nil
+}
+
+// SampleEventData 生成用于模板预览的示例数据
+func SampleEventData(event string) EventData {
+	now := time.Now()
+	data := EventData{
+		Event:          event,
+		OccurredAt:     now,
+		TaskID:         1,
+		TaskName:       "电影库",
+		AccountName:    "123云盘",
+		Status:         "已完成",
+		ProcessedCount: 1280,
+		AddedCount:     12,
+		DeletedCount:   3,
+		Duration:       12*time.Minute + 34*time.Second,
+		StartedAt:      now.Add(-(12*time.Minute + 34*time.Second)),
+		FinishedAt:     now,
+		Errors:         []string{"123Pan API 错误 (code: 429): 操作频繁", "扫描目录失败: /Movies/2024"},
+		AddedFiles:     []string{"/data/strm/Movies/New Movie (2024)/New Movie.strm", "/data/strm/TV/Show/Season 2/S02E01.strm", "/data/strm/TV/Show/Season 2/S02E02.strm"},
+		AddedGroups: []FileGroup{
+			{Folder: "Movies/New Movie (2024)", Titles: []string{"New Movie"}},
+			{Folder: "TV/Show/Season 2", Titles: []string{"S02E01", "S02E02"}},
+		},
+		AddedMore:    9,
+		DeletedFiles: []string{"/data/strm/Movies/Old Movie (2001)/Old Movie.strm", "/data/strm/Movies/Old Movie (2001)/poster.jpg", "/data/strm/TV/Show/S01E01.strm"},
+		Message:      "检测到多次登录失败\nIP: 203.0.113.9 (累计 10 次)\n用户名: admin (累计 10 次)",
+		Entries: []DigestEntry{
+			{Time: now.Add(-2 * time.Hour), Event: EventTaskSuccess, Title: "任务完成: 电影库"},
+			{Time: now.Add(-time.Hour), Event: EventTaskFailure, Title: "任务异常: 剧集库"},
+		},
+	}
+	switch event {
+	case EventAccountTokenFailure:
+		data.Message = "获取 AccessToken API 错误 (code: 401): client_secret 无效"
+	case EventDigest:
+		data.Message = "统计周期: " + now.Add(-time.Hour).Format("2006-01-02 15:04") + " 至 " + now.Format("2006-01-02 15:04")
+	}
+	return data
+}
@@ -0,0 +1,236 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PayloadVersion 当前结构化负载的版本号，字段有不兼容调整时递增
+const PayloadVersion = 1
+
+// 签名相关请求头
+const (
+	HeaderSignature = "X-CloudStream-Signature"
+	HeaderTimestamp = "X-CloudStream-Timestamp"
+	HeaderEvent     = "X-CloudStream-Event"
+	HeaderDelivery  = "X-CloudStream-Delivery"
+)
+
+// WebhookNotifier 通用 Webhook
+//
+// PayloadVersion 为 0 时发送兼容旧版的扁平字段 (title/body/content/msg)，
+// 为 1 时发送结构化负载；配置了 BodyTemplate 时以模板渲染结果作为请求体。
+// 配置 Secret 后对 "时间戳.请求体" 计算 HMAC-SHA256 签名。
+type WebhookNotifier struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method"` // 默认 POST
+	Headers        map[string]string `json:"headers"`
+	BodyTemplate   string            `json:"bodyTemplate"`
+	Secret         string            `json:"secret"`
+	PayloadVersion int               `json:"payloadVersion"`
+
+	tpl *template.Template
+}
+
+// WebhookPayload 结构化负载 (版本 1)
+type WebhookPayload struct {
+	Version   int             `json:"version"`
+	ID        string          `json:"id,omitempty"`
+	Event     string          `json:"event"`
+	Timestamp time.Time       `json:"timestamp"` // 事件发生时间
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Task      *PayloadTask    `json:"task"`
+	Account   *PayloadAccount `json:"account"`
+	Run       *PayloadRun     `json:"run"`
+	Message   string          `json:"message,omitempty"`
+	Entries   []DigestEntry   `json:"entries,omitempty"`
+}
+
+type PayloadTask struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type PayloadAccount struct {
+	Name string `json:"name"`
+}
+
+// PayloadRun 任务运行统计
+type PayloadRun struct {
+	Status          string      `json:"status"`
+	ProcessedCount  int         `json:"processedCount"`
+	AddedCount      int         `json:"addedCount"`
+	DeletedCount    int         `json:"deletedCount"`
+	DurationSeconds float64     `json:"durationSeconds"`
+	StartedAt       time.Time   `json:"startedAt"`
+	FinishedAt      time.Time   `json:"finishedAt"`
+	Errors          []string    `json:"errors"`
+	AddedFiles      []string    `json:"addedFiles"`
+	AddedGroups     []FileGroup `json:"addedGroups"`
+	DeletedFiles    []string    `json:"deletedFiles"`
+	FilesTruncated  bool        `json:"filesTruncated"` // 文件列表超出上限被截断，完整数量见 addedCount/deletedCount
+}
+
+var webhookMethods = map[string]bool{
+	http.MethodGet:   true,
+	http.MethodPost:  true,
+	http.MethodPut:   true,
+	http.MethodPatch: true,
+}
+
+func init() {
+	Register("webhook", func(settings json.RawMessage) (Notifier, error) {
+		n := &WebhookNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.URL == "" {
+			return nil, fmt.Errorf("Webhook URL 不能为空")
+		}
+		n.Method = strings.ToUpper(strings.TrimSpace(n.Method))
+		if n.Method == "" {
+			n.Method = http.MethodPost
+		}
+		if !webhookMethods[n.Method] {
+			return nil, fmt.Errorf("不支持的请求方法: %s", n.Method)
+		}
+		if n.PayloadVersion != 0 && n.PayloadVersion != PayloadVersion {
+			return nil, fmt.Errorf("不支持的负载版本: %d", n.PayloadVersion)
+		}
+		if n.BodyTemplate != "" {
+			tpl, err := template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(n.BodyTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("解析请求体模板失败: %w", err)
+			}
+			n.tpl = tpl
+		}
+		return n, nil
+	})
+}
+
+// toJSON 模板函数，将任意值编码为 JSON (字符串会带引号并转义)
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// BuildPayload 由消息构造结构化负载
+func BuildPayload(msg Message) WebhookPayload {
+	payload := WebhookPayload{
+		Version:   PayloadVersion,
+		ID:        msg.ID,
+		Event:     msg.Event,
+		Timestamp: time.Now(),
+		Title:     msg.Title,
+		Body:      msg.Body,
+	}
+	data := msg.Data
+	if data == nil {
+		return payload
+	}
+	if !data.OccurredAt.IsZero() {
+		payload.Timestamp = data.OccurredAt
+	}
+	payload.Message = data.Message
+	payload.Entries = data.Entries
+	if data.TaskID != 0 || data.TaskName != "" {
+		payload.Task = &PayloadTask{ID: data.TaskID, Name: data.TaskName}
+	}
+	if data.AccountName != "" {
+		payload.Account = &PayloadAccount{Name: data.AccountName}
+	}
+	if !data.StartedAt.IsZero() && data.Event != EventDigest {
+		payload.Run = &PayloadRun{
+			Status:          data.Status,
+			ProcessedCount:  data.ProcessedCount,
+			AddedCount:      data.AddedCount,
+			DeletedCount:    data.DeletedCount,
+			DurationSeconds: data.Duration.Seconds(),
+			StartedAt:       data.StartedAt,
+			FinishedAt:      data.FinishedAt,
+			Errors:          nonNil(data.Errors),
+			AddedFiles:      nonNil(data.AddedFiles),
+			AddedGroups:     data.AddedGroups,
+			DeletedFiles:    nonNil(data.DeletedFiles),
+			FilesTruncated:  data.FilesTruncated,
+		}
+	}
+	return payload
+}
+
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
+
+// SignPayload 计算签名: hex(HmacSHA256(secret, timestamp + "." + body))
+func SignPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n *WebhookNotifier) buildBody(msg Message) ([]byte, error) {
+	if n.PayloadVersion == 0 && n.tpl == nil {
+		return json.Marshal(map[string]string{
+			"title":   msg.Title,
+			"body":    msg.Body,
+			"content": msg.Body,
+			"msg":     msg.Body,
+		})
+	}
+	payload := BuildPayload(msg)
+	if n.tpl == nil {
+		return json.Marshal(payload)
+	}
+	var buf bytes.Buffer
+	if err := n.tpl.Execute(&buf, payload); err != nil {
+		return nil, fmt.Errorf("渲染请求体模板失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (n *WebhookNotifier) Send(msg Message) error {
+	body, err := n.buildBody(msg)
+	if err != nil {
+		return err
+	}
+
+	if n.Method == http.MethodGet {
+		body = nil
+	}
+	req, err := http.NewRequest(n.Method, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	if n.Method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(HeaderEvent, msg.Event)
+	if msg.ID != "" {
+		req.Header.Set(HeaderDelivery, msg.ID)
+	}
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, SignPayload(n.Secret, timestamp, body))
+	}
+	_, err = doRequest(req)
+	return err
+}
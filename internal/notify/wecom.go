@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// WeComNotifier 企业微信群机器人
+type WeComNotifier struct {
+	WebhookURL string `json:"webhookUrl"` // 完整地址，或只填 Key
+	Key        string `json:"key"`
+}
+
+func init() {
+	Register("wecom", func(settings json.RawMessage) (Notifier, error) {
+		n := &WeComNotifier{}
+		if err := decodeSettings(settings, n); err != nil {
+			return nil, err
+		}
+		if n.WebhookURL == "" {
+			if n.Key == "" {
+				return nil, fmt.Errorf("企业微信机器人地址或 Key 不能为空")
+			}
+			n.WebhookURL = "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=" + n.Key
+		}
+		return n, nil
+	})
+}
+
+func (n *WeComNotifier) Send(msg Message) error {
+	payload := map[string]interface{}{
+		"msgtype": "text",
+		"text": map[string]string{
+			"content": fmt.Sprintf("%s\n%s", msg.Title, msg.Body),
+		},
+	}
+	if msg.Format == FormatMarkdown {
+		payload = map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"content": fmt.Sprintf("**%s**\n%s", msg.Title, msg.Body),
+			},
+		}
+	}
+	body, err := postJSON(n.WebhookURL, payload, nil)
+	if err != nil {
+		return err
+	}
+	return checkJSONCode(body, "errcode", 0)
+}
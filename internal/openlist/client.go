@@ -3,6 +3,7 @@ package openlist
 import (
 	"bytes"
 	"cloudstream/internal/models"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,10 +11,23 @@ import (
 	"time"
 )
 
+// APIError OpenList 返回的错误码 (业务错误或非 2xx 的 HTTP 状态)
+type APIError struct {
+	Op      string
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("OpenList %s(code=%d): %s", e.Op, e.Code, e.Message)
+}
+
 type Client struct {
 	BaseURL    string
 	Token      string
 	HTTPClient *http.Client
+
+	ctx context.Context // 请求使用的 ctx，调用方取消后中断进行中的请求
 }
 
 func NewClient(account models.Account) *Client {
@@ -30,6 +44,20 @@ func NewClient(account models.Account) *Client {
 	}
 }
 
+// WithContext 返回绑定 ctx 的客户端副本
+func (c *Client) WithContext(ctx context.Context) *Client {
+	clone := *c
+	clone.ctx = ctx
+	return &clone
+}
+
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
 func (c *Client) doPostJSON(apiPath string, body any, out any) error {
 	if c.BaseURL == "" {
 		return fmt.Errorf("OpenList 地址未配置")
@@ -40,7 +68,7 @@ func (c *Client) doPostJSON(apiPath string, body any, out any) error {
 		return fmt.Errorf("编码 OpenList 请求失败: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, c.BaseURL+apiPath, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(c.context(), http.MethodPost, c.BaseURL+apiPath, bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("创建 OpenList 请求失败: %w", err)
 	}
@@ -56,6 +84,9 @@ func (c *Client) doPostJSON(apiPath string, body any, out any) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return &APIError{Op: "请求失败", Code: resp.StatusCode, Message: resp.Status}
+	}
 	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
 		return fmt.Errorf("解析 OpenList 响应失败: %w", err)
 	}
@@ -84,7 +115,7 @@ func (c *Client) ListDirectory(pathStr string, refresh bool) ([]FileInfo, error)
 		return nil, err
 	}
 	if res.Code != 200 {
-		return nil, fmt.Errorf("OpenList 列表失败(code=%d): %s", res.Code, res.Message)
+		return nil, &APIError{Op: "列表失败", Code: res.Code, Message: res.Message}
 	}
 
 	return res.Data.Content, nil
@@ -108,7 +139,7 @@ func (c *Client) GetRawURL(pathStr string) (string, error) {
 		return "", err
 	}
 	if res.Code != 200 {
-		return "", fmt.Errorf("OpenList 获取文件失败(code=%d): %s", res.Code, res.Message)
+		return "", &APIError{Op: "获取文件失败", Code: res.Code, Message: res.Message}
 	}
 	if res.Data.RawURL == "" {
 		return "", fmt.Errorf("OpenList 未返回 raw_url")
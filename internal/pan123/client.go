@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"cloudstream/internal/models"
 	"cloudstream/internal/openlist"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/rs/zerolog/log"
@@ -30,12 +31,17 @@ type tokenCacheItem struct {
 var (
 	tokenCaches = make(map[uint]*tokenCacheItem)
 	mapMutex    sync.Mutex
+
+	// TokenFailureHook 获取 AccessToken 失败时调用，由 core 注入通知实现
+	TokenFailureHook func(account models.Account, err error)
 )
 
 type Client struct {
 	HTTPClient     *http.Client
 	Account        models.Account
 	OpenListClient *openlist.Client
+
+	ctx context.Context // 限流等待和接口请求使用，调用方取消后不再排队并中断进行中的请求
 }
 
 func NewClient(account models.Account) *Client {
@@ -49,6 +55,23 @@ func NewClient(account models.Account) *Client {
 	return client
 }
 
+// WithContext 返回绑定 ctx 的客户端副本，限流排队和进行中的请求会随 ctx 取消而结束
+func (c *Client) WithContext(ctx context.Context) *Client {
+	clone := *c
+	clone.ctx = ctx
+	if c.OpenListClient != nil {
+		clone.OpenListClient = c.OpenListClient.WithContext(ctx)
+	}
+	return &clone
+}
+
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
 // 核心优化：双重检查锁获取 Token
 func (c *Client) getAccessToken() (string, error) {
 	mapMutex.Lock()
@@ -67,19 +90,30 @@ func (c *Client) getAccessToken() (string, error) {
 	cache.RUnlock()
 
 	cache.Lock()
-	defer cache.Unlock()
-
 	if cache.Token != "" && time.Now().Before(cache.ExpiresAt.Add(-5*time.Minute)) {
-		return cache.Token, nil
+		token := cache.Token
+		cache.Unlock()
+		return token, nil
 	}
+	token, err := c.requestAccessToken(cache)
+	cache.Unlock()
 
+	// 告警涉及数据库和通知，释放缓存锁后再调用，避免阻塞同一账户的其他请求；调用方取消导致的失败不告警
+	if err != nil && c.context().Err() == nil && TokenFailureHook != nil {
+		TokenFailureHook(c.Account, err)
+	}
+	return token, err
+}
+
+// requestAccessToken 向开放平台申请新的 AccessToken 并写入缓存，调用方需持有缓存写锁
+func (c *Client) requestAccessToken(cache *tokenCacheItem) (string, error) {
 	apiURL := ApiBaseURL + "/api/v1/access_token"
 	bodyData, _ := json.Marshal(map[string]string{
 		"client_id":     c.Account.ClientID,
 		"client_secret": c.Account.ClientSecret,
 	})
 
-	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewBuffer(bodyData))
+	req, err := http.NewRequestWithContext(c.context(), http.MethodPost, apiURL, bytes.NewBuffer(bodyData))
 	if err != nil {
 		return "", fmt.Errorf("创建 AccessToken 请求失败: %w", err)
 	}
@@ -89,7 +123,7 @@ func (c *Client) getAccessToken() (string, error) {
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("请求 AccessToken 失败: %w", err)
+		return "", httpError(0, fmt.Errorf("请求 AccessToken 失败: %w", err))
 	}
 	defer resp.Body.Close()
 
@@ -128,6 +162,20 @@ func ClearTokenCache(accountID uint) {
 	}
 }
 
+// authorizedCall 获取 AccessToken 并发送 GET 请求，按错误类型自动重试
+func (c *Client) authorizedCall(endpoint, apiPath string, params map[string]interface{}) (json.RawMessage, error) {
+	var rawData json.RawMessage
+	err := c.retry(endpoint, func() error {
+		accessToken, err := c.getAccessToken()
+		if err != nil {
+			return fmt.Errorf("获取 AccessToken 失败: %w", err)
+		}
+		rawData, err = c.sendAuthorizedRequest(http.MethodGet, apiPath, accessToken, params)
+		return err
+	})
+	return rawData, err
+}
+
 func (c *Client) sendAuthorizedRequest(method, endpoint, accessToken string, queryParams map[string]interface{}) (json.RawMessage, error) {
 	fullURL, _ := url.Parse(ApiBaseURL)
 	fullURL.Path = endpoint
@@ -139,7 +187,7 @@ func (c *Client) sendAuthorizedRequest(method, endpoint, accessToken string, que
 	}
 	fullURL.RawQuery = q.Encode()
 
-	req, err := http.NewRequest(method, fullURL.String(), nil)
+	req, err := http.NewRequestWithContext(c.context(), method, fullURL.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("创建授权请求失败: %w", err)
 	}
@@ -149,7 +197,7 @@ func (c *Client) sendAuthorizedRequest(method, endpoint, accessToken string, que
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("发送授权请求失败: %w", err)
+		return nil, httpError(0, fmt.Errorf("发送授权请求失败: %w", err))
 	}
 	defer resp.Body.Close()
 
@@ -158,20 +206,16 @@ func (c *Client) sendAuthorizedRequest(method, endpoint, accessToken string, que
 		Data json.RawMessage `json:"data"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("解析授权响应 JSON 失败: %w", err)
+		return nil, httpError(resp.StatusCode, fmt.Errorf("解析授权响应 JSON 失败 (HTTP %d): %w", resp.StatusCode, err))
 	}
 	if result.Code != 0 {
-		return nil, fmt.Errorf("123Pan API 错误 (code: %d): %s", result.Code, result.Message)
+		return nil, apiError(result.Code, result.Message)
 	}
 	return result.Data, nil
 }
 
 func (c *Client) ListFiles(parentFileId int64, limit int, lastFileId int64, parentPath string) ([]FileInfo, int64, error) {
 	if c.Account.Type == models.AccountType123Pan {
-		accessToken, err := c.getAccessToken()
-		if err != nil {
-			return nil, 0, fmt.Errorf("获取文件列表前，获取 AccessToken 失败: %w", err)
-		}
 		params := map[string]interface{}{
 			"parentFileId": parentFileId,
 			"limit":        limit,
@@ -182,7 +226,7 @@ func (c *Client) ListFiles(parentFileId int64, limit int, lastFileId int64, pare
 		if lastFileId > 0 {
 			params["lastFileId"] = lastFileId
 		}
-		rawData, err := c.sendAuthorizedRequest(http.MethodGet, "/api/v2/file/list", accessToken, params)
+		rawData, err := c.authorizedCall(EndpointList, "/api/v2/file/list", params)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -198,11 +242,65 @@ func (c *Client) ListFiles(parentFileId int64, limit int, lastFileId int64, pare
 	return []FileInfo{}, -1, nil
 }
 
+// GetFileDetail 查询单个文件或目录的详情 (含父目录 ID)
+func (c *Client) GetFileDetail(fileID int64) (*FileInfo, error) {
+	rawData, err := c.authorizedCall(EndpointList, "/api/v1/file/detail", map[string]interface{}{"fileID": fileID})
+	if err != nil {
+		return nil, err
+	}
+	var detail struct {
+		FileID       int64  `json:"fileID"`
+		FileName     string `json:"filename"`
+		Type         int    `json:"type"`
+		Size         int64  `json:"size"`
+		Etag         string `json:"etag"`
+		ParentFileID int64  `json:"parentFileID"`
+		Trashed      int    `json:"trashed"`
+	}
+	if err := json.Unmarshal(rawData, &detail); err != nil {
+		return nil, fmt.Errorf("解析文件详情失败: %w", err)
+	}
+	return &FileInfo{
+		FileId:       detail.FileID,
+		FileName:     detail.FileName,
+		FileType:     detail.Type,
+		Size:         detail.Size,
+		Etag:         detail.Etag,
+		ParentFileId: detail.ParentFileID,
+		Trashed:      detail.Trashed,
+	}, nil
+}
+
+// FindChild 在目录下按名称查找未删除的文件或子目录，找不到时返回 nil
+func (c *Client) FindChild(parentFileId int64, name string) (*FileInfo, error) {
+	var lastFileId int64
+	for {
+		files, next, err := c.ListFiles(parentFileId, 100, lastFileId, "")
+		if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			if files[i].FileName == name && files[i].Trashed == 0 {
+				return &files[i], nil
+			}
+		}
+		if next == -1 || len(files) == 0 {
+			return nil, nil
+		}
+		lastFileId = next
+	}
+}
+
 func (c *Client) ListOpenListDirectory(parentPath string) ([]FileInfo, error) {
 	if c.OpenListClient == nil {
 		return nil, fmt.Errorf("OpenList 客户端未初始化")
 	}
-	openListFiles, err := c.OpenListClient.ListDirectory(parentPath, false)
+	var openListFiles []openlist.FileInfo
+	err := c.retry(EndpointList, func() error {
+		var err error
+		openListFiles, err = c.OpenListClient.ListDirectory(parentPath, false)
+		return openListError(err)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("OpenList 列表失败: %w", err)
 	}
@@ -238,7 +336,13 @@ func (c *Client) GetDownloadURL(identifier interface{}) (string, error) {
 		if pathStr == "" {
 			return "", fmt.Errorf("OpenList 路径无效")
 		}
-		return c.OpenListClient.GetRawURL(pathStr)
+		var rawURL string
+		err := c.retry(EndpointDownloadInfo, func() error {
+			var err error
+			rawURL, err = c.OpenListClient.GetRawURL(pathStr)
+			return openListError(err)
+		})
+		return rawURL, err
 	}
 
 	var fileID int64
@@ -256,12 +360,8 @@ func (c *Client) GetDownloadURL(identifier interface{}) (string, error) {
 		return "", fmt.Errorf("不支持的参数类型")
 	}
 
-	accessToken, err := c.getAccessToken()
-	if err != nil {
-		return "", fmt.Errorf("获取 AccessToken 失败: %w", err)
-	}
 	params := map[string]interface{}{"fileId": strconv.FormatInt(fileID, 10)}
-	rawData, err := c.sendAuthorizedRequest(http.MethodGet, "/api/v1/file/download_info", accessToken, params)
+	rawData, err := c.authorizedCall(EndpointDownloadInfo, "/api/v1/file/download_info", params)
 	if err != nil {
 		return "", err
 	}
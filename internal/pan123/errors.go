@@ -0,0 +1,161 @@
+package pan123
+
+import (
+	"cloudstream/internal/openlist"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 云盘接口错误分类，可用 errors.Is(err, ErrRateLimited) 等判断
+var (
+	ErrRateLimited = errors.New("请求过于频繁")
+	ErrAuthExpired = errors.New("授权已失效")
+	ErrNotFound    = errors.New("文件不存在")
+	ErrTransient   = errors.New("临时错误")
+)
+
+// ProviderError 带分类的云盘接口错误，Error() 保持原始的错误描述
+type ProviderError struct {
+	Kind error // 上面的分类之一，无法归类时为 nil
+	Code int
+	Err  error
+}
+
+func (e *ProviderError) Error() string { return e.Err.Error() }
+
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+func (e *ProviderError) Is(target error) bool { return e.Kind != nil && e.Kind == target }
+
+// Retryable 限流、授权失效和临时错误可以重试
+func (e *ProviderError) Retryable() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrAuthExpired || e.Kind == ErrTransient
+}
+
+// apiError 按 123 云盘的错误码分类
+func apiError(code int, message string) error {
+	err := &ProviderError{Code: code, Err: fmt.Errorf("123Pan API 错误 (code: %d): %s", code, message)}
+	switch {
+	case code == 429:
+		err.Kind = ErrRateLimited
+	case code == 401:
+		err.Kind = ErrAuthExpired
+	case code == 404 || code == 5066 || strings.Contains(message, "不存在"):
+		err.Kind = ErrNotFound
+	case code >= 500 && code < 600:
+		err.Kind = ErrTransient
+	}
+	return err
+}
+
+// httpError 按 HTTP 状态码分类；网络错误视为临时错误
+func httpError(status int, err error) error {
+	kind := error(nil)
+	switch {
+	case status == 0 || status >= http.StatusInternalServerError:
+		kind = ErrTransient
+	case status == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case status == http.StatusUnauthorized:
+		kind = ErrAuthExpired
+	case status == http.StatusNotFound:
+		kind = ErrNotFound
+	}
+	return &ProviderError{Kind: kind, Code: status, Err: err}
+}
+
+// openListError 对 OpenList 客户端返回的错误分类
+func openListError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *openlist.APIError
+	if !errors.As(err, &apiErr) {
+		return &ProviderError{Kind: ErrTransient, Err: err}
+	}
+	pe := &ProviderError{Code: apiErr.Code, Err: err}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests:
+		pe.Kind = ErrRateLimited
+	case apiErr.Code == http.StatusUnauthorized:
+		// OpenList 使用固定令牌，重新请求无法恢复，不归为可重试的授权失效
+	case apiErr.Code == http.StatusNotFound || strings.Contains(strings.ToLower(apiErr.Message), "not found"):
+		pe.Kind = ErrNotFound
+	case apiErr.Code >= http.StatusInternalServerError:
+		pe.Kind = ErrTransient
+	}
+	return pe
+}
+
+// 重试参数
+const (
+	DefaultMaxAttempts = 4
+	retryBaseDelay     = time.Second
+	retryMaxDelay      = 30 * time.Second
+	rateLimitMinDelay  = 3 * time.Second
+)
+
+var maxAttempts atomic.Int32
+
+func init() {
+	maxAttempts.Store(DefaultMaxAttempts)
+}
+
+// SetMaxAttempts 设置单次接口调用的最大尝试次数 (含首次)，小于 1 时使用默认值
+func SetMaxAttempts(n int) {
+	if n < 1 {
+		n = DefaultMaxAttempts
+	}
+	maxAttempts.Store(int32(n))
+}
+
+// retryDelay 第 n 次失败后的等待时间：指数增长并加入随机抖动
+func retryDelay(attempt int, kind error) time.Duration {
+	d := retryBaseDelay << (attempt - 1)
+	if d > retryMaxDelay || d <= 0 {
+		d = retryMaxDelay
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if kind == ErrRateLimited && d < rateLimitMinDelay {
+		d = rateLimitMinDelay
+	}
+	return d
+}
+
+// retry 执行一次接口调用 (含限流排队)，遇到可重试的错误时退避后重试；
+// 授权失效时先清理 Token 缓存，下一次调用会重新获取
+func (c *Client) retry(endpoint string, call func() error) error {
+	limit := int(maxAttempts.Load())
+	for attempt := 1; ; attempt++ {
+		if err := c.wait(endpoint); err != nil {
+			return err
+		}
+		err := call()
+		if err == nil {
+			return nil
+		}
+		var pe *ProviderError
+		if !errors.As(err, &pe) || !pe.Retryable() || attempt >= limit {
+			return err
+		}
+		if pe.Kind == ErrAuthExpired {
+			ClearTokenCache(c.Account.ID)
+		}
+		delay := retryDelay(attempt, pe.Kind)
+		log.Warn().Err(err).Str("account", c.Account.Name).Str("endpoint", endpoint).
+			Int("attempt", attempt).Dur("delay", delay).Msg("云盘接口调用失败，稍后重试")
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.context().Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
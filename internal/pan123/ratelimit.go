@@ -0,0 +1,153 @@
+package pan123
+
+import (
+	"cloudstream/internal/models"
+	"context"
+	"sync"
+	"time"
+)
+
+// 限流的接口类别
+const (
+	EndpointList         = "list"          // 列目录
+	EndpointDownloadInfo = "download_info" // 获取下载直链
+)
+
+// 账户未配置时使用的默认限流参数
+const (
+	DefaultListQPS       = 3.0
+	DefaultListBurst     = 5
+	DefaultDownloadQPS   = 5.0
+	DefaultDownloadBurst = 10
+)
+
+// TokenBucket 令牌桶，以 qps 的速度补充令牌，最多积攒 burst 个
+type TokenBucket struct {
+	mu     sync.Mutex
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(qps float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{qps: qps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// refillLocked 按经过的时间补充令牌 (需持有 mu)
+func (b *TokenBucket) refillLocked(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.qps
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// SetRate 原地调整速率与容量，已积攒和已预占的令牌保持不变
+func (b *TokenBucket) SetRate(qps float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked(time.Now())
+	b.qps = qps
+	b.burst = float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Wait 取走一个令牌，令牌不足时排队等待；ctx 取消时归还预占的令牌
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	qps := b.qps
+	if qps <= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.refillLocked(time.Now())
+	b.tokens--
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(deficit / qps * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// accountLimiter 同一账户的扫描、文件浏览和播放共享的限流器
+type accountLimiter struct {
+	config   [4]float64
+	list     *TokenBucket
+	download *TokenBucket
+}
+
+var (
+	limiters     = make(map[uint]*accountLimiter)
+	limiterMutex sync.Mutex
+)
+
+func rateConfig(account models.Account) [4]float64 {
+	cfg := [4]float64{account.ListQPS, float64(account.ListBurst), account.DownloadQPS, float64(account.DownloadBurst)}
+	defaults := [4]float64{DefaultListQPS, DefaultListBurst, DefaultDownloadQPS, DefaultDownloadBurst}
+	for i := range cfg {
+		if cfg[i] <= 0 {
+			cfg[i] = defaults[i]
+		}
+	}
+	return cfg
+}
+
+// limiterFor 返回账户的共享限流器，按账户 ID 复用；限流参数变化时原地调整，
+// 持有旧账户快照的客户端与新客户端仍共用同一组令牌桶
+func limiterFor(account models.Account) *accountLimiter {
+	cfg := rateConfig(account)
+	limiterMutex.Lock()
+	defer limiterMutex.Unlock()
+	l, ok := limiters[account.ID]
+	if !ok {
+		l = &accountLimiter{
+			config:   cfg,
+			list:     NewTokenBucket(cfg[0], int(cfg[1])),
+			download: NewTokenBucket(cfg[2], int(cfg[3])),
+		}
+		limiters[account.ID] = l
+	} else if l.config != cfg {
+		l.config = cfg
+		l.list.SetRate(cfg[0], int(cfg[1]))
+		l.download.SetRate(cfg[2], int(cfg[3]))
+	}
+	return l
+}
+
+// ClearLimiter 账户删除后释放其限流器
+func ClearLimiter(accountID uint) {
+	limiterMutex.Lock()
+	delete(limiters, accountID)
+	limiterMutex.Unlock()
+}
+
+// wait 按接口类别取令牌
+func (c *Client) wait(endpoint string) error {
+	l := limiterFor(c.Account)
+	bucket := l.list
+	if endpoint == EndpointDownloadInfo {
+		bucket = l.download
+	}
+	return bucket.Wait(c.context())
+}
@@ -0,0 +1,165 @@
+package pan123
+
+import (
+	"cloudstream/internal/models"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurstThenRate(t *testing.T) {
+	b := NewTokenBucket(20, 3)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("积攒的令牌应立即可用，实际等待 %v", elapsed)
+	}
+	// 令牌耗尽后按 20 QPS 补充，下一次约等待 50ms
+	start = time.Now()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("令牌不足时的等待时间异常: %v", elapsed)
+	}
+}
+
+func TestTokenBucketUnlimited(t *testing.T) {
+	b := NewTokenBucket(0, 1)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		b.Wait(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("qps 为 0 时不应限流，实际耗时 %v", elapsed)
+	}
+}
+
+func TestTokenBucketCancelReturnsToken(t *testing.T) {
+	b := NewTokenBucket(1, 1)
+	b.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ctx 超时应返回错误，实际: %v", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// 取消的等待归还了预占的令牌，余额只受时间补充影响，不会继续为负
+	if b.tokens < -0.1 {
+		t.Errorf("取消后未归还令牌: %v", b.tokens)
+	}
+}
+
+func TestTokenBucketSetRate(t *testing.T) {
+	b := NewTokenBucket(1, 10)
+	b.SetRate(1000, 2)
+	b.mu.Lock()
+	tokens := b.tokens
+	b.mu.Unlock()
+	if tokens > 2 {
+		t.Fatalf("缩小容量后令牌数应被截断，实际 %v", tokens)
+	}
+	b.Wait(context.Background())
+	b.Wait(context.Background())
+	start := time.Now()
+	b.Wait(context.Background())
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("提高速率后应按新速率补充，实际等待 %v", elapsed)
+	}
+}
+
+func TestLimiterForReusesBuckets(t *testing.T) {
+	account := models.Account{ListQPS: 2, ListBurst: 2}
+	account.ID = 9001
+	defer ClearLimiter(account.ID)
+
+	first := limiterFor(account)
+	account.ListQPS = 50
+	second := limiterFor(account)
+	if first != second || first.list != second.list {
+		t.Fatal("同一账户修改限流参数后应复用原有令牌桶")
+	}
+	if second.list.qps != 50 {
+		t.Errorf("限流参数未原地更新: %v", second.list.qps)
+	}
+	if second.download.qps != DefaultDownloadQPS {
+		t.Errorf("未配置的参数应使用默认值: %v", second.download.qps)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 1; attempt <= 8; attempt++ {
+		base := retryBaseDelay << (attempt - 1)
+		if base > retryMaxDelay {
+			base = retryMaxDelay
+		}
+		for i := 0; i < 50; i++ {
+			d := retryDelay(attempt, ErrTransient)
+			// 抖动范围为 [base/2, base]
+			if d < base/2 || d > base {
+				t.Fatalf("第 %d 次重试的等待时间 %v 超出 [%v, %v]", attempt, d, base/2, base)
+			}
+		}
+	}
+	if d := retryDelay(100, ErrTransient); d > retryMaxDelay || d <= 0 {
+		t.Errorf("移位溢出时应使用最大等待时间，实际 %v", d)
+	}
+	for i := 0; i < 50; i++ {
+		if d := retryDelay(1, ErrRateLimited); d < rateLimitMinDelay {
+			t.Fatalf("限流错误的等待时间不应小于 %v，实际 %v", rateLimitMinDelay, d)
+		}
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		seen[retryDelay(3, ErrTransient)] = true
+	}
+	if len(seen) < 2 {
+		t.Error("等待时间应带有随机抖动")
+	}
+}
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestTokenFailureHookRunsWithoutCacheLock(t *testing.T) {
+	account := models.Account{Name: "hook"}
+	account.ID = 9002
+	defer ClearTokenCache(account.ID)
+
+	called := false
+	TokenFailureHook = func(a models.Account, err error) {
+		called = true
+		mapMutex.Lock()
+		cache := tokenCaches[a.ID]
+		mapMutex.Unlock()
+		if !cache.TryLock() {
+			t.Error("调用告警时仍持有 Token 缓存锁")
+			return
+		}
+		cache.Unlock()
+	}
+	defer func() { TokenFailureHook = nil }()
+
+	client := NewClient(account)
+	client.HTTPClient = &http.Client{Transport: failingTransport{}}
+	if _, err := client.getAccessToken(); err == nil {
+		t.Fatal("请求失败时应返回错误")
+	}
+	if !called {
+		t.Error("获取 Token 失败时应调用告警")
+	}
+}